@@ -0,0 +1,346 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v2"
+)
+
+// Config holds every setting of the server. Each setting is read from, in increasing priority,
+// its default, the yaml config file, the environment variable of its env tag and its command line flag,
+// the flag name is the env name in lower case with dashes, e.g. -access-token-ttl
+type Config struct {
+	Port     int            `yaml:"port" env:"PORT"`
+	Server   ServerConfig   `yaml:"server"`
+	Database DatabaseConfig `yaml:"database"`
+	Auth     AuthConfig     `yaml:"auth"`
+	JWT      JWTConfig      `yaml:"jwt"`
+	Notifier NotifierConfig `yaml:"notifier"`
+	Tracing  TracingConfig  `yaml:"tracing"`
+	Log      LogConfig      `yaml:"log"`
+}
+
+type ServerConfig struct {
+	// Time allowed to read a whole request, and only its headers
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT"`
+	// Time allowed to write the response
+	WriteTimeout time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+	// Time a keep-alive connection waits for the next request
+	IdleTimeout time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"`
+	// Time in-flight requests get to finish on shutdown before their connections are closed
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT"`
+	// Comma separated ips and cidrs of the proxies whose X-Forwarded-For header gives the client ip,
+	// no proxy is trusted when empty so a client can't pick the ip its failed logins are counted for
+	TrustedProxies string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+}
+
+/**
+ * Function to get the list of the trusted proxies, nil when no proxy is trusted
+ */
+func (s ServerConfig) TrustedProxyList() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(s.TrustedProxies, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+type DatabaseConfig struct {
+	// Driver is postgres, sqlite (the DSN is the database file) or memory (nothing is kept between restarts)
+	Driver string `yaml:"driver" env:"DB_DRIVER"`
+	DSN    string `yaml:"dsn" env:"DSN"`
+}
+
+type AuthConfig struct {
+	// Lifetime of the jwt access token
+	AccessTokenTTL time.Duration `yaml:"access_token_ttl" env:"ACCESS_TOKEN_TTL"`
+	// Lifetime of the opaque refresh token
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL"`
+	// Lifetime of the mfa challenge token returned by login
+	MFATokenTTL time.Duration `yaml:"mfa_token_ttl" env:"MFA_TOKEN_TTL"`
+	// Lifetime of a password reset token
+	PasswordResetTTL time.Duration `yaml:"password_reset_ttl" env:"PASSWORD_RESET_TTL"`
+	// Front end page that accepts the reset token, optional
+	PasswordResetURL string `yaml:"password_reset_url" env:"PASSWORD_RESET_URL"`
+	// Cost of the bcrypt password hash
+	BcryptCost int `yaml:"bcrypt_cost" env:"BCRYPT_COST"`
+}
+
+type JWTConfig struct {
+	// Directory of <kid>.pem signing keys, required unless EphemeralKeys is set
+	KeysDir string `yaml:"keys_dir" env:"JWT_KEYS_DIR"`
+	// Generate a signing key at startup when KeysDir is empty, for development only:
+	// the tokens don't survive a restart and other replicas don't accept them
+	EphemeralKeys bool `yaml:"ephemeral_keys" env:"JWT_EPHEMERAL_KEYS"`
+	// Key id of the signing key, other keys in KeysDir are only used for verification
+	ActiveKID string `yaml:"active_kid" env:"JWT_ACTIVE_KID"`
+}
+
+type NotifierConfig struct {
+	// Type is smtp, file or memory
+	Type string     `yaml:"type" env:"NOTIFIER"`
+	File string     `yaml:"file" env:"NOTIFIER_FILE"`
+	SMTP SMTPConfig `yaml:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host" env:"SMTP_HOST"`
+	Port     string `yaml:"port" env:"SMTP_PORT"`
+	Username string `yaml:"username" env:"SMTP_USERNAME"`
+	Password string `yaml:"password" env:"SMTP_PASSWORD"`
+	From     string `yaml:"from" env:"SMTP_FROM"`
+}
+
+type TracingConfig struct {
+	// Exporter is none, stdout, file (the spans are appended to File as json) or otlp (sent over http to OTLPEndpoint)
+	Exporter     string `yaml:"exporter" env:"TRACING_EXPORTER"`
+	File         string `yaml:"file" env:"TRACING_FILE"`
+	OTLPEndpoint string `yaml:"otlp_endpoint" env:"TRACING_OTLP_ENDPOINT"`
+	// Send the spans over plain http instead of https
+	OTLPInsecure bool `yaml:"otlp_insecure" env:"TRACING_OTLP_INSECURE"`
+	// Service name of the spans
+	ServiceName string `yaml:"service_name" env:"TRACING_SERVICE_NAME"`
+}
+
+type LogConfig struct {
+	// Level is debug, info, warn or error, request bodies are only logged at debug
+	Level string `yaml:"level" env:"LOG_LEVEL"`
+	// Format is json or text
+	Format string `yaml:"format" env:"LOG_FORMAT"`
+}
+
+// flagSetting is the command line flag of a setting
+type flagSetting struct {
+	field reflect.Value
+	value *string
+}
+
+/**
+ * Function to get the default config
+ */
+func Default() *Config {
+	return &Config{
+		Port: 3000,
+		Server: ServerConfig{
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       time.Minute,
+			ShutdownTimeout:   20 * time.Second,
+		},
+		Database: DatabaseConfig{Driver: "postgres"},
+		Auth: AuthConfig{
+			AccessTokenTTL:   15 * time.Minute,
+			RefreshTokenTTL:  30 * 24 * time.Hour,
+			MFATokenTTL:      5 * time.Minute,
+			PasswordResetTTL: time.Hour,
+			BcryptCost:       14,
+		},
+		Notifier: NotifierConfig{
+			Type: "file",
+			File: "notifications.log",
+			SMTP: SMTPConfig{Port: "587"},
+		},
+		Tracing: TracingConfig{
+			Exporter:     "none",
+			File:         "traces.json",
+			OTLPEndpoint: "localhost:4318",
+			ServiceName:  "ionixx",
+		},
+		Log: LogConfig{Level: "info", Format: "json"},
+	}
+}
+
+/**
+ * Function to load the config from the defaults, the config file, the environment and the command line arguments.
+ * The config file is given by -config or CONFIG_FILE, the variables of an optional .env file are added to the environment.
+ * Returns the arguments left after the flags
+ */
+func Load(args []string) (*Config, []string, error) {
+	// A missing .env file is fine, the environment can come from anywhere
+	if err := godotenv.Load(".env"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("loading .env: %w", err)
+	}
+
+	cfg := Default()
+	flags := flag.NewFlagSet("ionixx", flag.ContinueOnError)
+	path := flags.String("config", os.Getenv("CONFIG_FILE"), "path of the yaml config file")
+	// Flags are parsed first to find the config file, their values are set after the file and the environment
+	flagSettings := map[string]flagSetting{}
+	eachSetting(reflect.ValueOf(cfg).Elem(), func(field reflect.Value, env string) {
+		name := strings.ReplaceAll(strings.ToLower(env), "_", "-")
+		flagSettings[name] = flagSetting{field: field, value: flags.String(name, "", "overrides "+env)}
+	})
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *path != "" {
+		data, err := os.ReadFile(*path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading config file: %w", err)
+		}
+		// Unknown keys are rejected so typos don't go unnoticed
+		if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+			return nil, nil, fmt.Errorf("parsing config file %s: %w", *path, err)
+		}
+	}
+
+	var errs []string
+	eachSetting(reflect.ValueOf(cfg).Elem(), func(field reflect.Value, env string) {
+		// An empty variable keeps the value of the lower layers
+		if value := os.Getenv(env); value != "" {
+			if err := setValue(field, value); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", env, err))
+			}
+		}
+	})
+	flags.Visit(func(f *flag.Flag) {
+		if setting, ok := flagSettings[f.Name]; ok {
+			if err := setValue(setting.field, *setting.value); err != nil {
+				errs = append(errs, fmt.Sprintf("-%s: %v", f.Name, err))
+			}
+		}
+	})
+	if len(errs) > 0 {
+		return nil, nil, fmt.Errorf("invalid config:\n  %s", strings.Join(errs, "\n  "))
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, flags.Args(), nil
+}
+
+/**
+ * Function to check every setting, the error lists every invalid one
+ */
+func (cfg *Config) Validate() error {
+	var errs []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(cfg.Port > 0 && cfg.Port <= 65535, "PORT must be between 1 and 65535, got %d", cfg.Port)
+	check(cfg.Server.ReadTimeout > 0, "SERVER_READ_TIMEOUT must be positive, got %s", cfg.Server.ReadTimeout)
+	check(cfg.Server.ReadHeaderTimeout > 0, "SERVER_READ_HEADER_TIMEOUT must be positive, got %s", cfg.Server.ReadHeaderTimeout)
+	check(cfg.Server.WriteTimeout > 0, "SERVER_WRITE_TIMEOUT must be positive, got %s", cfg.Server.WriteTimeout)
+	check(cfg.Server.IdleTimeout > 0, "SERVER_IDLE_TIMEOUT must be positive, got %s", cfg.Server.IdleTimeout)
+	check(cfg.Server.ShutdownTimeout > 0, "SERVER_SHUTDOWN_TIMEOUT must be positive, got %s", cfg.Server.ShutdownTimeout)
+	for _, proxy := range cfg.Server.TrustedProxyList() {
+		_, _, cidrErr := net.ParseCIDR(proxy)
+		check(cidrErr == nil || net.ParseIP(proxy) != nil, "TRUSTED_PROXIES must hold ips or cidrs, got %q", proxy)
+	}
+
+	switch cfg.Database.Driver {
+	case "postgres", "sqlite":
+		check(cfg.Database.DSN != "", "DSN is required by the %s driver", cfg.Database.Driver)
+	case "memory":
+	default:
+		check(false, "DB_DRIVER must be postgres, sqlite or memory, got %q", cfg.Database.Driver)
+	}
+
+	check(cfg.Auth.AccessTokenTTL > 0, "ACCESS_TOKEN_TTL must be positive, got %s", cfg.Auth.AccessTokenTTL)
+	check(cfg.Auth.RefreshTokenTTL > 0, "REFRESH_TOKEN_TTL must be positive, got %s", cfg.Auth.RefreshTokenTTL)
+	check(cfg.Auth.MFATokenTTL > 0, "MFA_TOKEN_TTL must be positive, got %s", cfg.Auth.MFATokenTTL)
+	check(cfg.Auth.PasswordResetTTL > 0, "PASSWORD_RESET_TTL must be positive, got %s", cfg.Auth.PasswordResetTTL)
+	check(cfg.Auth.BcryptCost >= bcrypt.MinCost && cfg.Auth.BcryptCost <= bcrypt.MaxCost,
+		"BCRYPT_COST must be between %d and %d, got %d", bcrypt.MinCost, bcrypt.MaxCost, cfg.Auth.BcryptCost)
+
+	check(cfg.JWT.KeysDir != "" || cfg.JWT.EphemeralKeys, "JWT_KEYS_DIR is required, set JWT_EPHEMERAL_KEYS=true to generate a key for development")
+
+	switch cfg.Notifier.Type {
+	case "smtp":
+		check(cfg.Notifier.SMTP.Host != "", "SMTP_HOST is required by the smtp notifier")
+		check(cfg.Notifier.SMTP.Port != "", "SMTP_PORT is required by the smtp notifier")
+		check(cfg.Notifier.SMTP.From != "", "SMTP_FROM is required by the smtp notifier")
+	case "file":
+		check(cfg.Notifier.File != "", "NOTIFIER_FILE is required by the file notifier")
+	case "memory":
+	default:
+		check(false, "NOTIFIER must be smtp, file or memory, got %q", cfg.Notifier.Type)
+	}
+
+	switch cfg.Tracing.Exporter {
+	case "file":
+		check(cfg.Tracing.File != "", "TRACING_FILE is required by the file exporter")
+	case "otlp":
+		check(cfg.Tracing.OTLPEndpoint != "", "TRACING_OTLP_ENDPOINT is required by the otlp exporter")
+	case "none", "stdout":
+	default:
+		check(false, "TRACING_EXPORTER must be none, stdout, file or otlp, got %q", cfg.Tracing.Exporter)
+	}
+	check(cfg.Tracing.ServiceName != "", "TRACING_SERVICE_NAME must not be empty")
+
+	switch cfg.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		check(false, "LOG_LEVEL must be debug, info, warn or error, got %q", cfg.Log.Level)
+	}
+	check(cfg.Log.Format == "json" || cfg.Log.Format == "text", "LOG_FORMAT must be json or text, got %q", cfg.Log.Format)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+/**
+ * Function to call fn with every setting of the struct that has an env tag, nested structs included
+ */
+func eachSetting(v reflect.Value, fn func(field reflect.Value, env string)) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if env := v.Type().Field(i).Tag.Get("env"); env != "" {
+			fn(field, env)
+		} else if field.Kind() == reflect.Struct {
+			eachSetting(field, fn)
+		}
+	}
+}
+
+/**
+ * Function to parse the value into the setting by its type
+ */
+func setValue(field reflect.Value, value string) error {
+	switch {
+	case field.Type() == reflect.TypeOf(time.Duration(0)):
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration like 15m or 720h", value)
+		}
+		field.SetInt(int64(duration))
+	case field.Kind() == reflect.Int:
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		field.SetInt(int64(number))
+	case field.Kind() == reflect.Bool:
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		field.SetBool(enabled)
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+	return nil
+}
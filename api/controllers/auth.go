@@ -1,40 +1,69 @@
 package controllers
 
 import (
+	"ionixx/api/config"
+	"ionixx/api/limiter"
+	"ionixx/api/metrics"
 	"ionixx/api/models"
 	"ionixx/api/response"
+	"ionixx/api/signing"
 	"ionixx/api/storage"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
-	"golang.org/x/crypto/bcrypt"
 )
 
-type AuthController struct{}
+type AuthController struct {
+	store     *storage.Store
+	auth      config.AuthConfig
+	keys      *signing.KeySet
+	ipLimiter *limiter.Backoff
+	// unknownUserLimiter locks the user names without an account like the accounts are locked
+	unknownUserLimiter *limiter.Backoff
+}
+
+/**
+ * Function to create the auth controller, tokens are signed and verified with the keys
+ */
+func NewAuthController(store *storage.Store, auth config.AuthConfig, keys *signing.KeySet) *AuthController {
+	return &AuthController{
+		store:              store,
+		auth:               auth,
+		keys:               keys,
+		ipLimiter:          newLoginIPLimiter(),
+		unknownUserLimiter: newUnknownUserLimiter(),
+	}
+}
 
 /**
  * Function to generate Jwt token tith custom User claim
  */
-func generateToken(user models.User) (string, error) {
+func generateToken(auth config.AuthConfig, keys *signing.KeySet, user models.User, sessionID uint) (string, error) {
+	//Creating unique token id so the token can be revoked on its own
+	tokenID, err := generateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
 	//Creating custom jwt claims from user model
 	claims := &models.JwtCustomClaims{
-		UserID:   user.ID,
-		UserName: user.UserName,
+		UserID:    user.ID,
+		UserName:  user.UserName,
+		SessionID: sessionID,
+		Role:      user.Role,
+		TokenUse:  models.TokenUseAccess,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Hour * 48).Unix(),
+			ExpiresAt: time.Now().Add(auth.AccessTokenTTL).Unix(),
+			Id:        tokenID,
 			Issuer:    "ionixx",
 			IssuedAt:  time.Now().Unix(),
 		},
 	}
 
-	//Creating new jwt token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	//Signing the jwt token with the secret
-	signedToken, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	//Signing the jwt token with the active signing key
+	signedToken, err := keys.Sign(claims)
 
 	if err != nil {
 		return "", err
@@ -44,8 +73,14 @@ func generateToken(user models.User) (string, error) {
 }
 
 type LoginRequest struct {
-	UserName string `json:"user_name" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	UserName   string `json:"user_name" binding:"required"`
+	Password   string `json:"password" binding:"required"`
+	DeviceName string `json:"device_name"`
+}
+
+type LoginResponse struct {
+	User models.User `json:"user"`
+	TokenResponse
 }
 
 /**
@@ -57,62 +92,422 @@ type LoginRequest struct {
  *   	"success": true,
  *   	"message": "Login successful!",
  * 		"data": {
- * 			"id": 1,
- * 			"user_name": "test",
- * 			"full_name": "Test User",
- * 			"auth_token: "",
- * 			"dob": "2020-01-01T00:00:00Z",
- * 			"linkedin_url": "",
- * 			"created_at": "2020-01-01T00:00:00Z",
- * 			"updated_at": "2020-01-01T00:00:00Z",
+ * 			"user": {
+ * 				"id": 1,
+ * 				"user_name": "test",
+ * 				"full_name": "Test User",
+ * 				"email": "test@example.com",
+ * 				"dob": "2020-01-01T00:00:00Z",
+ * 				"linkedin_url": "",
+ * 				"role": "member",
+ * 				"created_at": "2020-01-01T00:00:00Z",
+ * 				"updated_at": "2020-01-01T00:00:00Z",
+ * 			},
+ * 			"access_token": "",
+ * 			"refresh_token": "",
+ * 			"token_type": "Bearer",
+ * 			"expires_in": 900
+ * 		}
+ * 	}
+ * @apiSuccessExample {json} MFA-Response:
+ *   HTTP/1.1 200 OK
+ *  {
+ *   	"success": true,
+ *   	"message": "MFA verification required!",
+ * 		"data": {
+ * 			"mfa_required": true,
+ * 			"mfa_token": "",
+ * 			"expires_in": 300
  * 		}
  * 	}
  * @apiErrorExample {json} Error-Response:
  * HTTP/1.1 400 Bad Request
+ * Content-Type: application/problem+json
  * {
- * 	"success": false,
- * 	"message": "Error logging in!",
- * 	"data": null
+ * 	"type": "about:blank",
+ * 	"title": "Bad Request",
+ * 	"status": 400,
+ * 	"detail": "Invalid username or password",
+ * 	"instance": "/auth/login",
+ * 	"code": "invalid_credentials",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
+ * @apiErrorExample {json} Locked-Response:
+ * HTTP/1.1 429 Too Many Requests
+ * Retry-After: 60
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Too Many Requests",
+ * 	"status": 429,
+ * 	"detail": "Too many failed login attempts, try again later",
+ * 	"instance": "/auth/login",
+ * 	"code": "too_many_attempts",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
  * }
  */
 func (a *AuthController) Login(c *gin.Context) {
+	store := a.store.WithContext(c.Request.Context())
+	//Count the attempt with the outcome it ends with
+	outcome := metrics.LoginError
+	defer func() { metrics.ObserveLogin(outcome) }()
 
 	var loginRequest LoginRequest
 	//Bind the request body to the login request
 	if err := c.ShouldBindJSON(&loginRequest); err != nil {
-		//If there is an error return bad request
-		response.ErrorJSON(c, http.StatusBadRequest, err.Error())
+		outcome = metrics.LoginInvalid
+		//If the request is invalid return the fields that failed
+		response.BindErrorJSON(c, err)
+		return
+	}
+
+	//Back off ips that failed too often before running bcrypt
+	if wait, ok := a.ipLimiter.Allow(c.ClientIP()); !ok {
+		outcome = metrics.LoginThrottled
+		respondLocked(c, wait)
 		return
 	}
 
-	var user models.User
 	//Find the user with the given username
-	result := storage.DB.Where("user_name = ?", loginRequest.UserName).First(&user)
-	//If the user is not found return bad request
-	if result.Error != nil {
-		response.ErrorJSON(c, http.StatusBadRequest, result.Error.Error())
+	user, err := store.Users.FindByUserName(loginRequest.UserName)
+	//If the user is not found return the same errors as a wrong password and a locked account
+	if err != nil {
+		if err != storage.ErrNotFound {
+			internalErrorJSON(c, err)
+			return
+		}
+		if wait, ok := a.unknownUserLimiter.Allow(loginRequest.UserName); !ok {
+			outcome = metrics.LoginLocked
+			respondLocked(c, wait)
+			return
+		}
+		outcome = metrics.LoginUnknownUser
+		a.ipLimiter.Failure(c.ClientIP())
+		a.unknownUserLimiter.Failure(loginRequest.UserName)
+		response.ErrorJSON(c, http.StatusBadRequest, response.CodeInvalidCredentials, "Invalid username or password")
+		return
+	}
+	//Locked accounts are rejected before running bcrypt
+	if wait, locked := accountLockedFor(*user); locked {
+		outcome = metrics.LoginLocked
+		respondLocked(c, wait)
 		return
 	}
 	//If the user is found check the password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(loginRequest.Password)); err != nil {
+	if err := comparePassword(c.Request.Context(), user.Password, loginRequest.Password); err != nil {
+		outcome = metrics.LoginWrongPassword
+		a.ipLimiter.Failure(c.ClientIP())
+		if err := recordFailedLogin(store, user); err != nil {
+			internalErrorJSON(c, err)
+			return
+		}
 		//If the password is incorrect return bad request
-		response.ErrorJSON(c, http.StatusBadRequest, "Invalid username or password")
+		response.ErrorJSON(c, http.StatusBadRequest, response.CodeInvalidCredentials, "Invalid username or password")
+		return
+	}
+	//The right password clears the failures of the ip, so users behind a shared ip aren't held back by earlier typos
+	a.ipLimiter.Reset(c.ClientIP())
+	//If mfa is enabled the tokens are only issued once the challenge is completed
+	if user.MFAEnabled {
+		challenge, err := generateMFAToken(a.auth, a.keys, *user)
+		if err != nil {
+			internalErrorJSON(c, err)
+			return
+		}
+		outcome = metrics.LoginMFARequired
+		response.SuccessJSON(c, http.StatusOK, "MFA verification required!", challenge)
+		return
+	}
+	//Reset the failed logins of the account
+	if err := clearFailedLogins(store, user); err != nil {
+		internalErrorJSON(c, err)
 		return
 	}
-	//If the password is correct generate the jwt token
-	token, err := generateToken(user)
+	//If the password is correct start a new session for this device
+	loginResponse, err := startSession(store, a.auth, a.keys, c, *user, loginRequest.DeviceName)
 	if err != nil {
-		//If there is an error return bad request
-		response.ErrorJSON(c, http.StatusBadRequest, err.Error())
+		internalErrorJSON(c, err)
 		return
 	}
-	//If token is generated successfully update the user with the token
-	result = storage.DB.Model(&user).Update("auth_token", token)
-	if result.Error != nil {
-		//If there is an error return bad request
-		response.ErrorJSON(c, http.StatusBadRequest, result.Error.Error())
+	//Login successful return the user and the tokens
+	outcome = metrics.LoginSuccess
+	response.SuccessJSON(c, http.StatusOK, "Login successful!", loginResponse)
+}
+
+/**
+ * Function to start a new session for the device of the request and issue its tokens
+ */
+func startSession(store *storage.Store, auth config.AuthConfig, keys *signing.KeySet, c *gin.Context, user models.User, deviceName string) (*LoginResponse, error) {
+	session := models.Session{
+		UserID:     user.ID,
+		DeviceName: deviceName,
+		UserAgent:  c.Request.UserAgent(),
+		IP:         c.ClientIP(),
+		LastSeenAt: time.Now(),
+	}
+	if err := store.Sessions.Create(&session); err != nil {
+		return nil, err
+	}
+	//Generate the access and refresh tokens
+	tokens, err := issueTokens(store, auth, keys, &user, &session)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResponse{
+		User:          user,
+		TokenResponse: *tokens,
+	}, nil
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+/**
+ * Function to exchange a refresh token for a new access token and a rotated refresh token
+ * @api {post} /auth/refresh Refresh
+ * @apiSuccessExample {json} Success-Response:
+ *   HTTP/1.1 200 OK
+ *  {
+ *   	"success": true,
+ *   	"message": "Token refreshed successfully!",
+ * 		"data": {
+ * 			"access_token": "",
+ * 			"refresh_token": "",
+ * 			"token_type": "Bearer",
+ * 			"expires_in": 900
+ * 		}
+ * 	}
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 401 Unauthorized
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Unauthorized",
+ * 	"status": 401,
+ * 	"detail": "Invalid refresh token",
+ * 	"instance": "/auth/refresh",
+ * 	"code": "invalid_token",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
+ */
+func (a *AuthController) Refresh(c *gin.Context) {
+	store := a.store.WithContext(c.Request.Context())
+	var refreshRequest RefreshRequest
+	//Bind the request body to the refresh request
+	if err := c.ShouldBindJSON(&refreshRequest); err != nil {
+		//If the request is invalid return the fields that failed
+		response.BindErrorJSON(c, err)
 		return
 	}
-	//Login successful return the user
-	response.SuccessJSON(c, http.StatusOK, "Login successful!", user)
+
+	//Find the refresh token by its hash
+	refreshToken, err := store.Tokens.FindRefreshToken(hashToken(refreshRequest.RefreshToken))
+	if err != nil {
+		response.ErrorJSON(c, http.StatusUnauthorized, response.CodeInvalidToken, "Invalid refresh token")
+		return
+	}
+
+	//A revoked token being presented again means it was leaked, so revoke the whole session
+	if refreshToken.RevokedAt != nil {
+		if err := store.Sessions.Revoke(refreshToken.SessionID); err != nil {
+			internalErrorJSON(c, err)
+			return
+		}
+		response.ErrorJSON(c, http.StatusUnauthorized, response.CodeTokenReuseDetected, "Refresh token reuse detected")
+		return
+	}
+
+	//If the refresh token is expired return unauthorized
+	if time.Now().After(refreshToken.ExpiresAt) {
+		response.ErrorJSON(c, http.StatusUnauthorized, response.CodeTokenExpired, "Refresh token expired")
+		return
+	}
+
+	//Mark the refresh token as used, only one concurrent request can win this update
+	used, err := store.Tokens.UseRefreshToken(refreshToken.ID)
+	if err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+	if !used {
+		if err := store.Sessions.Revoke(refreshToken.SessionID); err != nil {
+			internalErrorJSON(c, err)
+			return
+		}
+		response.ErrorJSON(c, http.StatusUnauthorized, response.CodeTokenReuseDetected, "Refresh token reuse detected")
+		return
+	}
+
+	//Find the owner of the refresh token
+	user, err := store.Users.FindByID(refreshToken.UserID)
+	if err != nil {
+		response.ErrorJSON(c, http.StatusUnauthorized, response.CodeInvalidToken, "Invalid refresh token")
+		return
+	}
+
+	//Find the active session the refresh token belongs to
+	session, err := store.Sessions.FindByID(refreshToken.SessionID)
+	if err != nil || session.RevokedAt != nil {
+		response.ErrorJSON(c, http.StatusUnauthorized, response.CodeSessionRevoked, "Session revoked")
+		return
+	}
+
+	//Issue new tokens for the same session
+	tokens, err := issueTokens(store, a.auth, a.keys, user, session)
+	if err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+	//Refresh successful return the tokens
+	response.SuccessJSON(c, http.StatusOK, "Token refreshed successfully!", tokens)
+}
+
+/**
+ * Function to logout the current session
+ * @api {post} /auth/logout Logout
+ * @apiSuccessExample {json} Success-Response:
+ *   HTTP/1.1 200 OK
+ *  {
+ *   	"success": true,
+ *   	"message": "Logout successful!",
+ * 		"data": null
+ * 	}
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 500 Internal Server Error
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Internal Server Error",
+ * 	"status": 500,
+ * 	"detail": "Internal server error",
+ * 	"instance": "/auth/logout",
+ * 	"code": "internal_error",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
+ */
+func (a *AuthController) Logout(c *gin.Context) {
+	//Revoke the session the request was made with
+	if err := a.store.WithContext(c.Request.Context()).Sessions.Revoke(c.GetUint("sessionId")); err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+	//Logout successful
+	response.SuccessJSON(c, http.StatusOK, "Logout successful!", nil)
+}
+
+/**
+ * Function to logout every session of the user
+ * @api {post} /auth/logout/all Logout everywhere
+ * @apiSuccessExample {json} Success-Response:
+ *   HTTP/1.1 200 OK
+ *  {
+ *   	"success": true,
+ *   	"message": "Logged out of all sessions!",
+ * 		"data": null
+ * 	}
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 500 Internal Server Error
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Internal Server Error",
+ * 	"status": 500,
+ * 	"detail": "Internal server error",
+ * 	"instance": "/auth/logout/all",
+ * 	"code": "internal_error",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
+ */
+func (a *AuthController) LogoutAll(c *gin.Context) {
+	//Revoke every session of the user
+	if err := a.store.WithContext(c.Request.Context()).Sessions.RevokeAll(c.GetUint("userId"), 0); err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+	//Logout successful
+	response.SuccessJSON(c, http.StatusOK, "Logged out of all sessions!", nil)
+}
+
+type RevokeRequest struct {
+	Token         string `json:"token" form:"token" binding:"required"`
+	TokenTypeHint string `json:"token_type_hint" form:"token_type_hint"`
+}
+
+/**
+ * Function to revoke an access or refresh token as described in RFC 7009.
+ * Unknown or invalid tokens are not an error, the response is the same either way.
+ * @api {post} /auth/revoke Revoke token
+ * @apiSuccessExample {json} Success-Response:
+ *   HTTP/1.1 200 OK
+ *  {
+ *   	"success": true,
+ *   	"message": "Token revoked successfully!",
+ * 		"data": null
+ * 	}
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 400 Bad Request
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Bad Request",
+ * 	"status": 400,
+ * 	"detail": "Unsupported token type hint id_token",
+ * 	"instance": "/auth/revoke",
+ * 	"code": "unsupported_token_type",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
+ */
+func (a *AuthController) Revoke(c *gin.Context) {
+	store := a.store.WithContext(c.Request.Context())
+	var revokeRequest RevokeRequest
+	//Bind the form or json body to the revoke request
+	if err := c.ShouldBind(&revokeRequest); err != nil {
+		response.ErrorJSON(c, http.StatusBadRequest, response.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	//Only the token types of RFC 7009 are supported as hints
+	hint := revokeRequest.TokenTypeHint
+	if hint != "" && hint != "access_token" && hint != "refresh_token" {
+		response.ErrorJSON(c, http.StatusBadRequest, response.CodeUnsupportedTokenType, "Unsupported token type hint "+hint)
+		return
+	}
+
+	//The hint only decides which token type is looked up first
+	lookups := []func(*storage.Store, string) error{revokeRefreshTokenString, a.revokeAccessTokenString}
+	if hint == "access_token" {
+		lookups = []func(*storage.Store, string) error{a.revokeAccessTokenString, revokeRefreshTokenString}
+	}
+	for _, lookup := range lookups {
+		if err := lookup(store, revokeRequest.Token); err == nil {
+			break
+		}
+	}
+
+	//Revocation successful, invalid tokens are silently ignored
+	response.SuccessJSON(c, http.StatusOK, "Token revoked successfully!", nil)
+}
+
+/**
+ * Function to revoke the session of a refresh token
+ */
+func revokeRefreshTokenString(store *storage.Store, token string) error {
+	refreshToken, err := store.Tokens.FindRefreshToken(hashToken(token))
+	if err != nil {
+		return err
+	}
+	//Revoking a refresh token also invalidates the access tokens of its session
+	return store.Sessions.Revoke(refreshToken.SessionID)
+}
+
+/**
+ * Function to revoke a signed access token
+ */
+func (a *AuthController) revokeAccessTokenString(store *storage.Store, token string) error {
+	claims := &models.JwtCustomClaims{}
+	if _, err := a.keys.Parse(token, claims); err != nil {
+		return err
+	}
+	return revokeAccessToken(store, claims)
 }
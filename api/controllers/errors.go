@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"errors"
+	"ionixx/api/response"
+	"ionixx/api/storage"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+/**
+ * Function to respond to an unexpected error, the client gets an internal error
+ * without the message and the error is logged with the request
+ */
+func internalErrorJSON(c *gin.Context, err error) {
+	c.Error(err)
+	response.ErrorJSON(c, http.StatusInternalServerError, response.CodeInternalError, "Internal server error")
+}
+
+/**
+ * Function to respond to an error finding a user, missing users are not found and other errors are internal
+ */
+func userErrorJSON(c *gin.Context, err error) {
+	if errors.Is(err, storage.ErrNotFound) {
+		response.ErrorJSON(c, http.StatusNotFound, response.CodeUserNotFound, "User not found")
+		return
+	}
+	internalErrorJSON(c, err)
+}
+
+/**
+ * Function to respond to an error saving a user, a user changed since it was read fails the If-Match
+ * of the client or conflicts with the other request when there was no If-Match
+ */
+func userWriteErrorJSON(c *gin.Context, err error) {
+	if errors.Is(err, storage.ErrConflict) {
+		if c.GetHeader("If-Match") != "" {
+			response.PreconditionFailedJSON(c)
+			return
+		}
+		response.ErrorJSON(c, http.StatusConflict, response.CodeVersionConflict, "The user was changed by another request, try again")
+		return
+	}
+	// The email is unique
+	if errors.Is(err, storage.ErrEmailTaken) {
+		response.ErrorJSON(c, http.StatusConflict, response.CodeEmailTaken, "The email is already taken")
+		return
+	}
+	userErrorJSON(c, err)
+}
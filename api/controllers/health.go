@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"ionixx/api/signing"
+	"ionixx/api/storage"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Time each readiness check gets before it fails
+const readinessCheckTimeout = 2 * time.Second
+
+type HealthController struct {
+	store *storage.Store
+	keys  *signing.KeySet
+}
+
+/**
+ * Function to create the health controller, the readiness checks the store and the signing keys
+ */
+func NewHealthController(store *storage.Store, keys *signing.KeySet) *HealthController {
+	return &HealthController{store: store, keys: keys}
+}
+
+type HealthCheck struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type HealthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+/**
+ * Function to report the process is alive, it checks nothing else so a slow database doesn't get the process restarted
+ * @api {get} /healthz Liveness
+ * @apiSuccessExample {json} Success-Response:
+ *  HTTP/1.1 200 OK
+ * {
+ * 	"status": "ok"
+ * }
+ */
+func (h *HealthController) Liveness(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+/**
+ * Function to report whether the server can serve requests: the database answers,
+ * every migration is applied and the active signing key signs tokens the keys verify
+ * @api {get} /readyz Readiness
+ * @apiSuccessExample {json} Success-Response:
+ *  HTTP/1.1 200 OK
+ * {
+ * 	"status": "ok",
+ * 	"checks": {
+ * 		"database": {"status": "ok", "latency_ms": 0.42},
+ * 		"migrations": {"status": "ok", "latency_ms": 0.87},
+ * 		"signing_keys": {"status": "ok", "latency_ms": 0}
+ * 	}
+ * }
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 503 Service Unavailable
+ * {
+ * 	"status": "fail",
+ * 	"checks": {
+ * 		"database": {"status": "fail", "latency_ms": 2000.31, "error": "context deadline exceeded"},
+ * 		...
+ * 	}
+ * }
+ */
+func (h *HealthController) Readiness(c *gin.Context) {
+	checks := map[string]func(ctx context.Context) error{
+		"database": h.store.Health.Ping,
+		"migrations": func(ctx context.Context) error {
+			pending, err := h.store.Health.PendingMigrations(ctx)
+			if err != nil {
+				return err
+			}
+			if pending > 0 {
+				return fmt.Errorf("%d migrations pending", pending)
+			}
+			return nil
+		},
+		// The active key must still sign tokens the keys verify
+		"signing_keys": func(ctx context.Context) error {
+			return h.keys.Check()
+		},
+	}
+
+	result := HealthResponse{Status: "ok", Checks: map[string]HealthCheck{}}
+	statusCode := http.StatusOK
+	for name, check := range checks {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), readinessCheckTimeout)
+		start := time.Now()
+		err := check(ctx)
+		cancel()
+
+		healthCheck := HealthCheck{Status: "ok", LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+		// Any failed check makes the server unready
+		if err != nil {
+			healthCheck.Status = "fail"
+			healthCheck.Error = err.Error()
+			result.Status = "fail"
+			statusCode = http.StatusServiceUnavailable
+		}
+		result.Checks[name] = healthCheck
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(statusCode, result)
+}
@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"ionixx/api/signing"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JWKSController struct {
+	keys *signing.KeySet
+}
+
+/**
+ * Function to create the jwks controller publishing the public part of the keys
+ */
+func NewJWKSController(keys *signing.KeySet) *JWKSController {
+	return &JWKSController{keys: keys}
+}
+
+/**
+ * Function to publish the public signing keys so other services can verify tokens
+ * @api {get} /.well-known/jwks.json Get json web key set
+ * @apiSuccessExample {json} Success-Response:
+ *   HTTP/1.1 200 OK
+ *  {
+ * 		"keys": [
+ * 			{
+ * 				"kty": "OKP",
+ * 				"kid": "2022-06",
+ * 				"use": "sig",
+ * 				"alg": "EdDSA",
+ * 				"crv": "Ed25519",
+ * 				"x": "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"
+ * 			}
+ * 		]
+ * 	}
+ */
+func (j *JWKSController) GetJWKS(c *gin.Context) {
+	// Allow verifiers to cache the key set for a short while
+	c.Header("Cache-Control", "public, max-age=300")
+	// The key set is served as is, verifiers expect the RFC 7517 document
+	c.JSON(http.StatusOK, j.keys.JWKS())
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"fmt"
+	"ionixx/api/limiter"
+	"ionixx/api/models"
+	"ionixx/api/response"
+	"ionixx/api/storage"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Failed logins after which the account is locked
+	accountLockoutThreshold = 5
+	// Failed logins from one ip after which the ip has to back off
+	ipLockoutThreshold = 20
+	// First lockout delay, doubled on every further failure
+	lockoutBaseDelay = time.Minute
+	// Upper bound of the lockout delay
+	lockoutMaxDelay = time.Hour
+)
+
+// Lockout of the accounts by their failed logins
+var accountLockout = storage.Lockout{Threshold: accountLockoutThreshold, BaseDelay: lockoutBaseDelay, MaxDelay: lockoutMaxDelay}
+
+/**
+ * Function to create the limiter of failed logins per ip
+ */
+func newLoginIPLimiter() *limiter.Backoff {
+	return limiter.NewBackoff(ipLockoutThreshold, lockoutBaseDelay, lockoutMaxDelay, 24*time.Hour)
+}
+
+/**
+ * Function to create the limiter of failed logins per user name without an account, they are locked
+ * like accounts so the lockout doesn't reveal which accounts exist
+ */
+func newUnknownUserLimiter() *limiter.Backoff {
+	return limiter.NewBackoff(accountLockoutThreshold, lockoutBaseDelay, lockoutMaxDelay, 24*time.Hour)
+}
+
+/**
+ * Function to check if the account is locked, returns how long it stays locked
+ */
+func accountLockedFor(user models.User) (time.Duration, bool) {
+	if user.LockedUntil == nil {
+		return 0, false
+	}
+	wait := time.Until(*user.LockedUntil)
+	return wait, wait > 0
+}
+
+/**
+ * Function to count a failed login of the account and lock it once the threshold is reached
+ */
+func recordFailedLogin(store *storage.Store, user *models.User) error {
+	// Count and lock in the store so concurrent failures are all counted and lock the account with the count they reach
+	return store.Users.IncrementFailedLogins(user, accountLockout)
+}
+
+/**
+ * Function to reset the failed logins of the account
+ */
+func clearFailedLogins(store *storage.Store, user *models.User) error {
+	if user.FailedLoginAttempts == 0 && user.LockedUntil == nil {
+		return nil
+	}
+	user.FailedLoginAttempts = 0
+	user.LockedUntil = nil
+	return store.Users.Update(user, "failed_login_attempts", "locked_until")
+}
+
+/**
+ * Function to respond with too many requests and the seconds to wait
+ */
+func respondLocked(c *gin.Context, wait time.Duration) {
+	respondThrottled(c, wait, "Too many failed login attempts, try again later")
+}
+
+/**
+ * Function to respond with too many requests, the detail and the seconds to wait
+ */
+func respondThrottled(c *gin.Context, wait time.Duration, detail string) {
+	c.Header("Retry-After", fmt.Sprint(int64(math.Ceil(wait.Seconds()))))
+	response.ErrorJSON(c, http.StatusTooManyRequests, response.CodeTooManyAttempts, detail)
+}
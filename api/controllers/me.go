@@ -0,0 +1,189 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+/**
+ * Function to get the logged in user, clients don't need to know their own id
+ * @api {get} /me Get current user
+ * @apiHeader {String} [If-None-Match] ETag the client has, answered with 304 Not Modified when it is still current
+ * @apiSuccessExample {json} Success-Response:
+ *   HTTP/1.1 200 OK
+ * ETag: "1-3"
+ *  {
+ * 		"success": true,
+ * 		"message": "User fetched successfully!",
+ * 		"data": {
+ * 			"id": 1,
+ * 			"user_name": "test",
+ * 			"full_name": "Test User",
+ * 			"email": "test@example.com",
+ * 			"dob": "2020-01-01T00:00:00Z",
+ * 			"linkedin_url": "",
+ * 			"role": "member",
+ * 			"created_at": "2020-01-01T00:00:00Z",
+ * 			"updated_at": "2020-01-01T00:00:00Z"
+ * 		}
+ * 	}
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 401 Unauthorized
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Unauthorized",
+ * 	"status": 401,
+ * 	"detail": "Invalid token",
+ * 	"instance": "/me",
+ * 	"code": "invalid_token",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
+ */
+func (u *UserController) GetMe(c *gin.Context) {
+	u.getUser(c, currentUserID)
+}
+
+/**
+ * Function to update the logged in user, only the given fields are updated
+ * @api {put} /me Update current user
+ * @apiHeader {String} [If-Match] ETag the user was read with, the write fails with 412 when the user changed since
+ * @apiSuccessExample {json} Success-Response:
+ * HTTP/1.1 200 OK
+ * ETag: "1-4"
+ * {
+ * 	"success": true,
+ * 	"message": "User updated successfully!",
+ * 	"data": {
+ * 		"id": 1,
+ * 		"user_name": "test",
+ * 		"full_name": "Test User",
+ * 		"email": "test@example.com",
+ * 		"dob": "2020-01-01T00:00:00Z",
+ * 		"linkedin_url": "",
+ * 		"role": "member",
+ * 		"created_at": "2020-01-01T00:00:00Z",
+ * 		"updated_at": "2020-01-01T00:00:00Z"
+ * 	}
+ * }
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 422 Unprocessable Entity
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Unprocessable Entity",
+ * 	"status": 422,
+ * 	"detail": "The request has invalid fields",
+ * 	"instance": "/me",
+ * 	"code": "validation_failed",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f",
+ * 	"errors": [
+ * 		{"field": "email", "constraint": "email", "message": "email must be a valid email address"}
+ * 	]
+ * }
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 412 Precondition Failed
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Precondition Failed",
+ * 	"status": 412,
+ * 	"detail": "The resource was changed since it was read, get it again",
+ * 	"instance": "/me",
+ * 	"code": "precondition_failed",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
+ */
+func (u *UserController) UpdateMe(c *gin.Context) {
+	u.updateUser(c, currentUserID)
+}
+
+/**
+ * Function to patch the logged in user with a JSON Merge Patch or a JSON Patch, like the patch of a user by id
+ * @api {patch} /me Patch current user
+ * @apiHeader {String} [If-Match] ETag the user was read with, the write fails with 412 when the user changed since
+ * @apiSuccessExample {json} Success-Response:
+ * HTTP/1.1 200 OK
+ * ETag: "1-4"
+ * {
+ * 	"success": true,
+ * 	"message": "User updated successfully!",
+ * 	"data": {
+ * 		"id": 1,
+ * 		"user_name": "test",
+ * 		"full_name": "Test User",
+ * 		"email": "test@example.com",
+ * 		"dob": null,
+ * 		"linkedin_url": "",
+ * 		"role": "member",
+ * 		"created_at": "2020-01-01T00:00:00Z",
+ * 		"updated_at": "2020-01-01T00:00:00Z"
+ * 	}
+ * }
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 409 Conflict
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Conflict",
+ * 	"status": 409,
+ * 	"detail": "test failed",
+ * 	"instance": "/me",
+ * 	"code": "patch_conflict",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 412 Precondition Failed
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Precondition Failed",
+ * 	"status": 412,
+ * 	"detail": "The resource was changed since it was read, get it again",
+ * 	"instance": "/me",
+ * 	"code": "precondition_failed",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
+ */
+func (u *UserController) PatchMe(c *gin.Context) {
+	u.patchUser(c, currentUserID)
+}
+
+/**
+ * Function to delete the logged in user, every session of the user is logged out
+ * @api {delete} /me Delete current user
+ * @apiHeader {String} [If-Match] ETag the user was read with, the write fails with 412 when the user changed since
+ * @apiSuccessExample {json} Success-Response:
+ * HTTP/1.1 200 OK
+ * {
+ * 	"success": true,
+ * 	"message": "User deleted successfully!",
+ * 	"data": null
+ * }
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 401 Unauthorized
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Unauthorized",
+ * 	"status": 401,
+ * 	"detail": "Token revoked",
+ * 	"instance": "/me",
+ * 	"code": "token_revoked",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 412 Precondition Failed
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Precondition Failed",
+ * 	"status": 412,
+ * 	"detail": "The resource was changed since it was read, get it again",
+ * 	"instance": "/me",
+ * 	"code": "precondition_failed",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
+ */
+func (u *UserController) DeleteMe(c *gin.Context) {
+	u.deleteUser(c, currentUserID)
+}
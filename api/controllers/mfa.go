@@ -0,0 +1,525 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"image/png"
+	"ionixx/api/config"
+	"ionixx/api/models"
+	"ionixx/api/response"
+	"ionixx/api/signing"
+	"ionixx/api/storage"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	// Number of recovery codes generated when mfa is enabled
+	recoveryCodeCount = 10
+	// Seconds each totp code is valid for, the default of the authenticator apps
+	totpPeriod = 30
+)
+
+var (
+	// Errors of a wrong second factor, any other error of a check is unexpected
+	errInvalidMFACode      = errors.New("Invalid MFA code")
+	errInvalidRecoveryCode = errors.New("Invalid recovery code")
+)
+
+type MFAController struct {
+	store *storage.Store
+	auth  config.AuthConfig
+	keys  *signing.KeySet
+}
+
+/**
+ * Function to create the mfa controller, the challenge tokens are verified with the keys
+ */
+func NewMFAController(store *storage.Store, auth config.AuthConfig, keys *signing.KeySet) *MFAController {
+	return &MFAController{store: store, auth: auth, keys: keys}
+}
+
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+/**
+ * Function to generate the short lived token that must be exchanged at /auth/mfa/verify
+ */
+func generateMFAToken(auth config.AuthConfig, keys *signing.KeySet, user models.User) (*MFAChallengeResponse, error) {
+	// Creating unique token id so the challenge can only be completed once
+	tokenID, err := generateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &models.JwtCustomClaims{
+		UserID:   user.ID,
+		UserName: user.UserName,
+		TokenUse: models.TokenUseMFA,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(auth.MFATokenTTL).Unix(),
+			Id:        tokenID,
+			Issuer:    "ionixx",
+			IssuedAt:  time.Now().Unix(),
+		},
+	}
+
+	signedToken, err := keys.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    signedToken,
+		ExpiresIn:   int64(auth.MFATokenTTL.Seconds()),
+	}, nil
+}
+
+/**
+ * Function to replace the recovery codes of the user, only the hashes are stored
+ */
+func generateRecoveryCodes(store *storage.Store, userID uint) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		bytes := make([]byte, 5)
+		if _, err := rand.Read(bytes); err != nil {
+			return nil, err
+		}
+		// Format the code as xxxxx-xxxxx so it is easy to type
+		encoded := hex.EncodeToString(bytes)
+		code := encoded[:5] + "-" + encoded[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashToken(code))
+	}
+
+	// Replace the previous recovery codes
+	if err := store.RecoveryCodes.Replace(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+/**
+ * Function to check a totp code of the user, RFC 6238 allows each code to be accepted once
+ * so its time step must come after the step of the last accepted code
+ */
+func useTOTPCode(store *storage.Store, user models.User, code string) (bool, error) {
+	step, ok := totpStep(code, user.TOTPSecret, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return store.Users.UseTOTPStep(user.ID, step)
+}
+
+/**
+ * Function to get the time step of a totp code, the steps before and after the current one
+ * are accepted too for the clock drift of the authenticator like totp.Validate does
+ */
+func totpStep(code string, secret string, now time.Time) (int64, bool) {
+	current := now.Unix() / totpPeriod
+	for _, step := range []int64{current, current - 1, current + 1} {
+		expected, err := totp.GenerateCodeCustom(secret, time.Unix(step*totpPeriod, 0), totp.ValidateOpts{
+			Period:    totpPeriod,
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err == nil && subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+/**
+ * Function to check a totp code or use up a recovery code of the user
+ */
+func verifySecondFactor(store *storage.Store, user models.User, code string, recoveryCode string) error {
+	if code != "" {
+		used, err := useTOTPCode(store, user, code)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return errInvalidMFACode
+		}
+		return nil
+	}
+
+	// Mark the recovery code as used, only one concurrent request can win this update
+	used, err := store.RecoveryCodes.Use(user.ID, hashToken(recoveryCode))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return errInvalidRecoveryCode
+	}
+	return nil
+}
+
+type MFAEnrollResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+	QRCode          string `json:"qr_code"`
+}
+
+/**
+ * Function to start the totp enrollment of the logged in user
+ * @api {post} /auth/mfa/enroll Enroll mfa
+ * @apiSuccessExample {json} Success-Response:
+ *   HTTP/1.1 200 OK
+ *  {
+ *   	"success": true,
+ *   	"message": "Scan the QR code and confirm with a code!",
+ * 		"data": {
+ * 			"secret": "JBSWY3DPEHPK3PXP",
+ * 			"provisioning_uri": "otpauth://totp/ionixx:test?algorithm=SHA1&digits=6&issuer=ionixx&period=30&secret=JBSWY3DPEHPK3PXP",
+ * 			"qr_code": "data:image/png;base64,"
+ * 		}
+ * 	}
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 400 Bad Request
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Bad Request",
+ * 	"status": 400,
+ * 	"detail": "MFA is already enabled",
+ * 	"instance": "/auth/mfa/enroll",
+ * 	"code": "mfa_already_enabled",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
+ */
+func (m *MFAController) Enroll(c *gin.Context) {
+	store := m.store.WithContext(c.Request.Context())
+	// Get the logged in user
+	user, err := store.Users.FindByID(c.GetUint("userId"))
+	if err != nil {
+		userErrorJSON(c, err)
+		return
+	}
+
+	// Enrolling again would lock out the configured authenticator
+	if user.MFAEnabled {
+		response.ErrorJSON(c, http.StatusBadRequest, response.CodeMFAAlreadyEnabled, "MFA is already enabled")
+		return
+	}
+
+	// Generate a new totp secret
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      "ionixx",
+		AccountName: user.UserName,
+	})
+	if err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+
+	// Render the provisioning uri as a png QR code
+	image, err := key.Image(256, 256)
+	if err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+	var qrCode bytes.Buffer
+	if err := png.Encode(&qrCode, image); err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+
+	// Save the secret, mfa stays disabled until the secret is confirmed
+	user.TOTPSecret = key.Secret()
+	if err := store.Users.Update(user, "totp_secret"); err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+
+	response.SuccessJSON(c, http.StatusOK, "Scan the QR code and confirm with a code!", &MFAEnrollResponse{
+		Secret:          key.Secret(),
+		ProvisioningURI: key.URL(),
+		QRCode:          "data:image/png;base64," + base64.StdEncoding.EncodeToString(qrCode.Bytes()),
+	})
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
+}
+
+type MFARecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+/**
+ * Function to confirm the totp enrollment with a code and enable mfa
+ * @api {post} /auth/mfa/confirm Confirm mfa
+ * @apiSuccessExample {json} Success-Response:
+ *   HTTP/1.1 200 OK
+ *  {
+ *   	"success": true,
+ *   	"message": "MFA enabled successfully, store the recovery codes safely!",
+ * 		"data": {
+ * 			"recovery_codes": ["a1b2c-3d4e5"]
+ * 		}
+ * 	}
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 400 Bad Request
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Bad Request",
+ * 	"status": 400,
+ * 	"detail": "Invalid MFA code",
+ * 	"instance": "/auth/mfa/confirm",
+ * 	"code": "invalid_mfa_code",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
+ */
+func (m *MFAController) Confirm(c *gin.Context) {
+	store := m.store.WithContext(c.Request.Context())
+	var codeRequest MFACodeRequest
+	// Bind the request body to the code request
+	if err := c.ShouldBindJSON(&codeRequest); err != nil {
+		response.BindErrorJSON(c, err)
+		return
+	}
+
+	// Get the logged in user
+	user, err := store.Users.FindByID(c.GetUint("userId"))
+	if err != nil {
+		userErrorJSON(c, err)
+		return
+	}
+
+	// The enrollment must be started first
+	if user.MFAEnabled || user.TOTPSecret == "" {
+		response.ErrorJSON(c, http.StatusBadRequest, response.CodeMFANotEnrolled, "MFA enrollment not started")
+		return
+	}
+
+	// Check the code against the pending secret
+	used, err := useTOTPCode(store, *user, codeRequest.Code)
+	if err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+	if !used {
+		response.ErrorJSON(c, http.StatusBadRequest, response.CodeInvalidMFACode, "Invalid MFA code")
+		return
+	}
+
+	// Generate the recovery codes
+	codes, err := generateRecoveryCodes(store, user.ID)
+	if err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+
+	// Enable mfa
+	user.MFAEnabled = true
+	if err := store.Users.Update(user, "mfa_enabled"); err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+
+	response.SuccessJSON(c, http.StatusOK, "MFA enabled successfully, store the recovery codes safely!", &MFARecoveryCodesResponse{
+		RecoveryCodes: codes,
+	})
+}
+
+type MFAVerifyRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code" binding:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recovery_code"`
+	DeviceName   string `json:"device_name"`
+}
+
+/**
+ * Function to complete the mfa challenge of login with a totp or recovery code
+ * @api {post} /auth/mfa/verify Verify mfa
+ * @apiSuccessExample {json} Success-Response:
+ *   HTTP/1.1 200 OK
+ *  {
+ *   	"success": true,
+ *   	"message": "Login successful!",
+ * 		"data": {
+ * 			"user": {
+ * 				"id": 1,
+ * 				"user_name": "test",
+ * 				"mfa_enabled": true
+ * 			},
+ * 			"access_token": "",
+ * 			"refresh_token": "",
+ * 			"token_type": "Bearer",
+ * 			"expires_in": 900
+ * 		}
+ * 	}
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 401 Unauthorized
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Unauthorized",
+ * 	"status": 401,
+ * 	"detail": "Invalid MFA code",
+ * 	"instance": "/auth/mfa/verify",
+ * 	"code": "invalid_mfa_code",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
+ */
+func (m *MFAController) Verify(c *gin.Context) {
+	store := m.store.WithContext(c.Request.Context())
+	var verifyRequest MFAVerifyRequest
+	// Bind the request body to the verify request
+	if err := c.ShouldBindJSON(&verifyRequest); err != nil {
+		response.BindErrorJSON(c, err)
+		return
+	}
+
+	// Parse the challenge token returned by login
+	claims := &models.JwtCustomClaims{}
+	if _, err := m.keys.Parse(verifyRequest.MFAToken, claims); err != nil || claims.TokenUse != models.TokenUseMFA || claims.Id == "" {
+		response.ErrorJSON(c, http.StatusUnauthorized, response.CodeInvalidToken, "Invalid MFA token")
+		return
+	}
+
+	// A completed challenge is on the denylist of the revoked tokens, it is checked before the code is used up
+	if used, err := store.Tokens.IsAccessTokenRevoked(claims.Id); err != nil || used {
+		response.ErrorJSON(c, http.StatusUnauthorized, response.CodeInvalidToken, "Invalid MFA token")
+		return
+	}
+
+	// Get the user of the challenge
+	user, err := store.Users.FindByID(claims.UserID)
+	if err != nil || !user.MFAEnabled {
+		response.ErrorJSON(c, http.StatusUnauthorized, response.CodeInvalidToken, "Invalid MFA token")
+		return
+	}
+
+	// Locked accounts can not complete the challenge either
+	if wait, locked := accountLockedFor(*user); locked {
+		respondLocked(c, wait)
+		return
+	}
+
+	// Check the second factor, wrong codes count as failed logins
+	if err := verifySecondFactor(store, *user, verifyRequest.Code, verifyRequest.RecoveryCode); err != nil {
+		if err != errInvalidMFACode && err != errInvalidRecoveryCode {
+			internalErrorJSON(c, err)
+			return
+		}
+		if err := recordFailedLogin(store, user); err != nil {
+			internalErrorJSON(c, err)
+			return
+		}
+		response.ErrorJSON(c, http.StatusUnauthorized, response.CodeInvalidMFACode, err.Error())
+		return
+	}
+
+	// Use up the challenge, only one concurrent request can complete it
+	used, err := store.Tokens.UseMFAChallenge(claims.Id, time.Unix(claims.ExpiresAt, 0))
+	if err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+	if !used {
+		response.ErrorJSON(c, http.StatusUnauthorized, response.CodeInvalidToken, "Invalid MFA token")
+		return
+	}
+
+	// Reset the failed logins of the account
+	if err := clearFailedLogins(store, user); err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+
+	// Start the session of the device
+	loginResponse, err := startSession(store, m.auth, m.keys, c, *user, verifyRequest.DeviceName)
+	if err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+	//Login successful return the user and the tokens
+	response.SuccessJSON(c, http.StatusOK, "Login successful!", loginResponse)
+}
+
+/**
+ * Function to disable mfa of the logged in user with a current totp code
+ * @api {post} /auth/mfa/disable Disable mfa
+ * @apiSuccessExample {json} Success-Response:
+ *   HTTP/1.1 200 OK
+ *  {
+ *   	"success": true,
+ *   	"message": "MFA disabled successfully!",
+ * 		"data": null
+ * 	}
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 400 Bad Request
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Bad Request",
+ * 	"status": 400,
+ * 	"detail": "Invalid MFA code",
+ * 	"instance": "/auth/mfa/disable",
+ * 	"code": "invalid_mfa_code",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
+ */
+func (m *MFAController) Disable(c *gin.Context) {
+	store := m.store.WithContext(c.Request.Context())
+	var codeRequest MFACodeRequest
+	// Bind the request body to the code request
+	if err := c.ShouldBindJSON(&codeRequest); err != nil {
+		response.BindErrorJSON(c, err)
+		return
+	}
+
+	// Get the logged in user
+	user, err := store.Users.FindByID(c.GetUint("userId"))
+	if err != nil {
+		userErrorJSON(c, err)
+		return
+	}
+
+	if !user.MFAEnabled {
+		response.ErrorJSON(c, http.StatusBadRequest, response.CodeMFANotEnabled, "MFA is not enabled")
+		return
+	}
+	// Only a valid code of the authenticator can disable mfa
+	used, err := useTOTPCode(store, *user, codeRequest.Code)
+	if err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+	if !used {
+		response.ErrorJSON(c, http.StatusBadRequest, response.CodeInvalidMFACode, "Invalid MFA code")
+		return
+	}
+
+	// Remove the secret and the recovery codes
+	user.MFAEnabled = false
+	user.TOTPSecret = ""
+	if err := store.Users.Update(user, "mfa_enabled", "totp_secret"); err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+	if err := store.RecoveryCodes.DeleteAll(user.ID); err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+
+	response.SuccessJSON(c, http.StatusOK, "MFA disabled successfully!", nil)
+}
@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ionixx/api/models"
+	"ionixx/api/storage"
+	"strings"
+	"time"
+)
+
+const (
+	// Number of users returned when no limit is given
+	defaultPageLimit = 20
+	// Largest number of users returned in a single page
+	maxPageLimit = 100
+)
+
+var errInvalidCursor = errors.New("Invalid cursor")
+
+// pageSort is the parsed sort parameter
+type pageSort struct {
+	Field string
+	Desc  bool
+	field storage.UserSortField
+}
+
+// pageCursor is the position after the last row of a page, it is sent to the client base64 encoded
+type pageCursor struct {
+	Sort  string      `json:"s"`
+	Value interface{} `json:"v"`
+	ID    uint        `json:"id"`
+}
+
+/**
+ * Function to parse a sort parameter like "full_name" or "-created_at"
+ */
+func parseSort(sort string) (pageSort, error) {
+	if sort == "" {
+		sort = "id"
+	}
+	parsed := pageSort{Field: strings.TrimPrefix(sort, "-"), Desc: strings.HasPrefix(sort, "-")}
+	field, ok := storage.UserSortFields[parsed.Field]
+	if !ok {
+		return parsed, fmt.Errorf("Invalid sort field %q", parsed.Field)
+	}
+	parsed.field = field
+	return parsed, nil
+}
+
+/**
+ * Function to get the sort parameter back from the parsed sort
+ */
+func (s pageSort) String() string {
+	if s.Desc {
+		return "-" + s.Field
+	}
+	return s.Field
+}
+
+/**
+ * Function to encode the cursor pointing after the given user
+ */
+func (s pageSort) EncodeCursor(user models.User) string {
+	cursor := pageCursor{Sort: s.String(), ID: user.ID}
+	if s.Field != "id" {
+		cursor.Value = storage.UserSortValue(user, s.Field)
+	}
+	// Time values are stored in UTC so the cursor does not depend on the server time zone
+	if t, ok := cursor.Value.(time.Time); ok {
+		cursor.Value = t.UTC().Format(time.RFC3339Nano)
+	}
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+/**
+ * Function to decode a cursor into the position of the user it points after
+ */
+func (s pageSort) DecodeCursor(cursor string) (*storage.UserCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var decoded pageCursor
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.Sort != s.String() {
+		// A cursor is only valid for the sort it was created with
+		return nil, errInvalidCursor
+	}
+	if s.Field == "id" {
+		return &storage.UserCursor{ID: decoded.ID}, nil
+	}
+
+	// Only nullable fields can point after a null value
+	if decoded.Value == nil {
+		if !s.field.Nullable {
+			return nil, errInvalidCursor
+		}
+		return &storage.UserCursor{ID: decoded.ID}, nil
+	}
+	text, ok := decoded.Value.(string)
+	if !ok {
+		return nil, errInvalidCursor
+	}
+	if !s.field.Time {
+		return &storage.UserCursor{Value: text, ID: decoded.ID}, nil
+	}
+	value, err := time.Parse(time.RFC3339Nano, text)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	return &storage.UserCursor{Value: value, ID: decoded.ID}, nil
+}
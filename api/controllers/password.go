@@ -0,0 +1,448 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ionixx/api/config"
+	"ionixx/api/limiter"
+	"ionixx/api/logging"
+	"ionixx/api/metrics"
+	"ionixx/api/models"
+	"ionixx/api/notify"
+	"ionixx/api/response"
+	"ionixx/api/storage"
+	"ionixx/api/tracing"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// Password resets waiting to be sent, further requests are dropped while the queue is full
+	resetQueueSize = 100
+	// Password resets sent at the same time
+	resetWorkers = 4
+	// Password reset requests from one ip after which the ip has to back off
+	resetIPThreshold = 20
+	// Password reset requests for one account after which the account has to back off
+	resetAccountThreshold = 3
+)
+
+// passwordReset is a forgot password request waiting to be sent, with the context of the request
+type passwordReset struct {
+	ctx     context.Context
+	request ForgotPasswordRequest
+}
+
+type PasswordController struct {
+	store    *storage.Store
+	auth     config.AuthConfig
+	notifier notify.Notifier
+
+	ipLimiter      *limiter.Backoff
+	accountLimiter *limiter.Backoff
+
+	// The workers send the queued password resets until the queue is closed by Drain
+	mu      sync.Mutex
+	closed  bool
+	resets  chan passwordReset
+	workers sync.WaitGroup
+}
+
+/**
+ * Function to create the password controller, reset tokens are sent with the notifier in the background.
+ * The controller must be drained before the store is closed
+ */
+func NewPasswordController(store *storage.Store, auth config.AuthConfig, notifier notify.Notifier) *PasswordController {
+	p := &PasswordController{
+		store:          store,
+		auth:           auth,
+		notifier:       notifier,
+		ipLimiter:      limiter.NewBackoff(resetIPThreshold, lockoutBaseDelay, lockoutMaxDelay, time.Hour),
+		accountLimiter: limiter.NewBackoff(resetAccountThreshold, lockoutBaseDelay, lockoutMaxDelay, time.Hour),
+		resets:         make(chan passwordReset, resetQueueSize),
+	}
+	p.workers.Add(resetWorkers)
+	for i := 0; i < resetWorkers; i++ {
+		go p.sendResets()
+	}
+	return p
+}
+
+/**
+ * Function to hash a password with bcrypt at the given cost
+ */
+func hashPassword(ctx context.Context, password string, cost int) (string, error) {
+	defer metrics.ObserveBcrypt("hash", time.Now())
+	_, span := tracing.Start(ctx, "bcrypt.hash", trace.WithAttributes(attribute.Int("bcrypt.cost", cost)))
+	defer span.End()
+	hashedPasswordBytes, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedPasswordBytes), nil
+}
+
+/**
+ * Function to check a password against its bcrypt hash
+ */
+func comparePassword(ctx context.Context, hashedPassword string, password string) error {
+	defer metrics.ObserveBcrypt("compare", time.Now())
+	_, span := tracing.Start(ctx, "bcrypt.compare")
+	defer span.End()
+	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+}
+
+type ForgotPasswordRequest struct {
+	UserName string `json:"user_name" binding:"required_without=Email"`
+	Email    string `json:"email" binding:"omitempty,email"`
+}
+
+/**
+ * Function to send a password reset token to the email of the user.
+ * The response is the same whether the user exists or not, the user is looked up and the token sent
+ * in the background so the response time doesn't reveal the account either. Requests are throttled per ip
+ * and per user name or email, whether the account exists or not.
+ * @api {post} /auth/password/forgot Forgot password
+ * @apiSuccessExample {json} Success-Response:
+ *   HTTP/1.1 200 OK
+ *  {
+ *   	"success": true,
+ *   	"message": "If the account exists, a password reset token has been sent!",
+ * 		"data": null
+ * 	}
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 422 Unprocessable Entity
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Unprocessable Entity",
+ * 	"status": 422,
+ * 	"detail": "The request has invalid fields",
+ * 	"instance": "/auth/password/forgot",
+ * 	"code": "validation_failed",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f",
+ * 	"errors": [
+ * 		{"field": "email", "constraint": "email", "message": "email must be a valid email address"}
+ * 	]
+ * }
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 429 Too Many Requests
+ * Retry-After: 60
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Too Many Requests",
+ * 	"status": 429,
+ * 	"detail": "Too many password reset requests, try again later",
+ * 	"instance": "/auth/password/forgot",
+ * 	"code": "too_many_attempts",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
+ */
+func (p *PasswordController) ForgotPassword(c *gin.Context) {
+	var forgotRequest ForgotPasswordRequest
+	// Bind the request body to the forgot password request
+	if err := c.ShouldBindJSON(&forgotRequest); err != nil {
+		response.BindErrorJSON(c, err)
+		return
+	}
+
+	// Throttle the ip and the account asked for, unknown accounts included so the throttling reveals nothing
+	accountKey := "user_name:" + strings.ToLower(forgotRequest.UserName)
+	if forgotRequest.UserName == "" {
+		accountKey = "email:" + strings.ToLower(forgotRequest.Email)
+	}
+	for _, throttle := range []struct {
+		limiter *limiter.Backoff
+		key     string
+	}{{p.ipLimiter, c.ClientIP()}, {p.accountLimiter, accountKey}} {
+		if wait, ok := throttle.limiter.Allow(throttle.key); !ok {
+			respondThrottled(c, wait, "Too many password reset requests, try again later")
+			return
+		}
+	}
+	p.ipLimiter.Failure(c.ClientIP())
+	p.accountLimiter.Failure(accountKey)
+
+	// The request context is canceled once the response is sent, the logger and the trace are kept
+	ctx := context.WithoutCancel(c.Request.Context())
+	if !p.enqueue(passwordReset{ctx: ctx, request: forgotRequest}) {
+		logging.FromContext(ctx).Warn("Password reset queue is full, the request is dropped")
+	}
+
+	// Return the same response for known and unknown users
+	response.SuccessJSON(c, http.StatusOK, "If the account exists, a password reset token has been sent!", nil)
+}
+
+/**
+ * Function to send a password reset token to the user of the request, unknown users and users without an email get nothing
+ */
+func (p *PasswordController) forgotPassword(store *storage.Store, forgotRequest ForgotPasswordRequest) error {
+	// Find the user by user name or email
+	var user *models.User
+	var err error
+	if forgotRequest.UserName != "" {
+		user, err = store.Users.FindByUserName(forgotRequest.UserName)
+	} else {
+		user, err = store.Users.FindByEmail(forgotRequest.Email)
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Only users with an email can receive a reset token
+	if user.Email == "" {
+		return nil
+	}
+	return p.sendPasswordResetToken(store, *user)
+}
+
+/**
+ * Function to queue a password reset, false when the queue is full or drained
+ */
+func (p *PasswordController) enqueue(reset passwordReset) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return false
+	}
+	select {
+	case p.resets <- reset:
+		return true
+	default:
+		return false
+	}
+}
+
+/**
+ * Function to send the queued password resets until the queue is closed
+ */
+func (p *PasswordController) sendResets() {
+	defer p.workers.Done()
+	for reset := range p.resets {
+		if err := p.forgotPassword(p.store.WithContext(reset.ctx), reset.request); err != nil {
+			logging.FromContext(reset.ctx).Error("Error sending password reset token", slog.String("error", err.Error()))
+		}
+	}
+}
+
+/**
+ * Function to stop taking password resets and wait until the queued ones are sent or the context is done
+ */
+func (p *PasswordController) Drain(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.resets)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+/**
+ * Function to create a password reset token and send it to the user
+ */
+func (p *PasswordController) sendPasswordResetToken(store *storage.Store, user models.User) error {
+	// Invalidate the reset tokens sent before
+	if err := store.PasswordResets.InvalidateAll(user.ID); err != nil {
+		return err
+	}
+
+	// Generate the reset token
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	// Save only the hash of the reset token
+	err = store.PasswordResets.Create(&models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(p.auth.PasswordResetTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Hello %s,\n\nUse the token below to reset your password, it expires in %s.\n\nReset token: %s\n", user.FullName, p.auth.PasswordResetTTL, token)
+	// Include a link when the front end reset page is configured
+	if resetURL := p.auth.PasswordResetURL; resetURL != "" {
+		body += fmt.Sprintf("\nOr open %s?token=%s\n", resetURL, token)
+	}
+
+	return p.notifier.Send(notify.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    body,
+	})
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+/**
+ * Function to reset the password with a reset token and logout every session
+ * @api {post} /auth/password/reset Reset password
+ * @apiSuccessExample {json} Success-Response:
+ *   HTTP/1.1 200 OK
+ *  {
+ *   	"success": true,
+ *   	"message": "Password reset successfully!",
+ * 		"data": null
+ * 	}
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 400 Bad Request
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Bad Request",
+ * 	"status": 400,
+ * 	"detail": "Invalid or expired reset token",
+ * 	"instance": "/auth/password/reset",
+ * 	"code": "invalid_reset_token",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
+ */
+func (p *PasswordController) ResetPassword(c *gin.Context) {
+	store := p.store.WithContext(c.Request.Context())
+	var resetRequest ResetPasswordRequest
+	// Bind the request body to the reset password request
+	if err := c.ShouldBindJSON(&resetRequest); err != nil {
+		response.BindErrorJSON(c, err)
+		return
+	}
+
+	// Use up the unexpired reset token, only one concurrent request can get it
+	resetToken, err := store.PasswordResets.Use(hashToken(resetRequest.Token))
+	if err == storage.ErrNotFound {
+		response.ErrorJSON(c, http.StatusBadRequest, response.CodeInvalidResetToken, "Invalid or expired reset token")
+		return
+	}
+	if err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+
+	// Hash the new password
+	hashedPassword, err := hashPassword(c.Request.Context(), resetRequest.Password, p.auth.BcryptCost)
+	if err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+
+	// Save the new password
+	user := &models.User{Password: hashedPassword}
+	user.ID = resetToken.UserID
+	if err := store.Users.Update(user, "password"); err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+
+	// Logout every session since the old password may have been compromised
+	if err := store.Sessions.RevokeAll(resetToken.UserID, 0); err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+
+	// Return a success response
+	response.SuccessJSON(c, http.StatusOK, "Password reset successfully!", nil)
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=6,nefield=CurrentPassword"`
+}
+
+/**
+ * Function to change the password of the logged in user and logout their other sessions, also served at /me/password
+ * @api {put} /users/:id/password Change password
+ * @apiSuccessExample {json} Success-Response:
+ *   HTTP/1.1 200 OK
+ *  {
+ *   	"success": true,
+ *   	"message": "Password changed successfully!",
+ * 		"data": null
+ * 	}
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 400 Bad Request
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Bad Request",
+ * 	"status": 400,
+ * 	"detail": "Invalid current password",
+ * 	"instance": "/users/1/password",
+ * 	"code": "wrong_current_password",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
+ */
+func (p *PasswordController) ChangePassword(c *gin.Context) {
+	store := p.store.WithContext(c.Request.Context())
+	var changeRequest ChangePasswordRequest
+	// Bind the request body to the change password request
+	if err := c.ShouldBindJSON(&changeRequest); err != nil {
+		response.BindErrorJSON(c, err)
+		return
+	}
+
+	// Get the logged in user, only users themselves can change their password
+	user, err := store.Users.FindByID(c.GetUint("userId"))
+	if err != nil {
+		userErrorJSON(c, err)
+		return
+	}
+
+	// Check the current password
+	if err := comparePassword(c.Request.Context(), user.Password, changeRequest.CurrentPassword); err != nil {
+		response.ErrorJSON(c, http.StatusBadRequest, response.CodeWrongCurrentPassword, "Invalid current password")
+		return
+	}
+
+	// Hash the new password
+	hashedPassword, err := hashPassword(c.Request.Context(), changeRequest.NewPassword, p.auth.BcryptCost)
+	if err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+
+	// Save the new password
+	user.Password = hashedPassword
+	if err := store.Users.Update(user, "password"); err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+
+	// Logout every other session, the current session stays logged in
+	if err := store.Sessions.RevokeAll(user.ID, c.GetUint("sessionId")); err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+
+	// Return a success response
+	response.SuccessJSON(c, http.StatusOK, "Password changed successfully!", nil)
+}
@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"ionixx/api/models"
+	"ionixx/api/response"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+const (
+	// MergePatchContentType is the media type of a JSON Merge Patch, RFC 7386
+	MergePatchContentType = "application/merge-patch+json"
+	// JSONPatchContentType is the media type of a JSON Patch, RFC 6902
+	JSONPatchContentType = "application/json-patch+json"
+)
+
+// Fields of the patch document that can be read but never patched
+var immutableUserFields = []string{"id", "user_name", "created_at", "updated_at"}
+
+// Fields a patch can add without them being fields of the user, they are never saved
+var writeOnlyUserFields = map[string]bool{"current_password": true}
+
+// userDocument is the user as a patch sees it, the patched fields and the immutable ones
+type userDocument struct {
+	ID          uint       `json:"id"`
+	UserName    string     `json:"user_name"`
+	FullName    string     `json:"full_name"`
+	Email       string     `json:"email"`
+	Dob         *time.Time `json:"dob"`
+	LinkedinURL string     `json:"linkedin_url"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// PatchUserRequest is the user once patched, null and removed fields are cleared
+type PatchUserRequest struct {
+	FullName    string     `json:"full_name" binding:"required"`
+	Email       string     `json:"email" binding:"omitempty,email"`
+	Dob         *time.Time `json:"dob"`
+	LinkedinURL string     `json:"linkedin_url"`
+	// CurrentPassword is required when users change their own email
+	CurrentPassword string `json:"current_password"`
+}
+
+/**
+ * Function to apply the merge patch or json patch of the request to the user.
+ * The problem is sent and false returned when the patch can't be applied or the patched user is invalid
+ */
+func patchUserRequest(c *gin.Context, user *models.User) (*PatchUserRequest, bool) {
+	patch, err := c.GetRawData()
+	if err != nil {
+		response.ErrorJSON(c, http.StatusBadRequest, response.CodeInvalidRequest, err.Error())
+		return nil, false
+	}
+
+	original, err := json.Marshal(&userDocument{
+		ID:          user.ID,
+		UserName:    user.UserName,
+		FullName:    user.FullName,
+		Email:       user.Email,
+		Dob:         user.Dob,
+		LinkedinURL: user.LinkedinURL,
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+	})
+	if err != nil {
+		internalErrorJSON(c, err)
+		return nil, false
+	}
+
+	// Apply the patch of the content type to the document of the user
+	var patched []byte
+	switch c.ContentType() {
+	case MergePatchContentType:
+		// The fields of the merge patch replace the fields of the user, null removes the field
+		if patched, err = jsonpatch.MergePatch(original, patch); err != nil {
+			response.ErrorJSON(c, http.StatusBadRequest, response.CodeInvalidRequest, err.Error())
+			return nil, false
+		}
+	case JSONPatchContentType:
+		operations, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			response.ErrorJSON(c, http.StatusBadRequest, response.CodeInvalidRequest, err.Error())
+			return nil, false
+		}
+		// Operations on missing paths and failed tests don't fit the current user
+		if patched, err = operations.Apply(original); err != nil {
+			response.ErrorJSON(c, http.StatusConflict, response.CodePatchConflict, err.Error())
+			return nil, false
+		}
+	default:
+		c.Header("Accept-Patch", MergePatchContentType+", "+JSONPatchContentType)
+		response.ErrorJSON(c, http.StatusUnsupportedMediaType, response.CodeUnsupportedMediaType,
+			fmt.Sprintf("The patch must be %s or %s", MergePatchContentType, JSONPatchContentType))
+		return nil, false
+	}
+
+	// A patch replacing the whole document can leave something else than an object
+	var before, after map[string]interface{}
+	if err := json.Unmarshal(original, &before); err != nil {
+		internalErrorJSON(c, err)
+		return nil, false
+	}
+	if err := json.Unmarshal(patched, &after); err != nil {
+		response.ErrorJSON(c, http.StatusBadRequest, response.CodeInvalidRequest, "The patched user must be a json object")
+		return nil, false
+	}
+	// The patch can't touch the immutable fields nor add fields the user doesn't have
+	if fieldErrors := patchFieldErrors(before, after); len(fieldErrors) > 0 {
+		response.ValidationErrorJSON(c, fieldErrors)
+		return nil, false
+	}
+
+	var patchRequest PatchUserRequest
+	if err := json.Unmarshal(patched, &patchRequest); err != nil {
+		response.BindErrorJSON(c, err)
+		return nil, false
+	}
+	// Validate the patched user with the rules of the other requests
+	if err := binding.Validator.ValidateStruct(&patchRequest); err != nil {
+		response.BindErrorJSON(c, err)
+		return nil, false
+	}
+	return &patchRequest, true
+}
+
+/**
+ * Function to get the errors of the fields a patch is not allowed to change
+ */
+func patchFieldErrors(before map[string]interface{}, after map[string]interface{}) []response.FieldError {
+	fieldErrors := []response.FieldError{}
+	for _, field := range immutableUserFields {
+		if value, ok := after[field]; !ok || !reflect.DeepEqual(value, before[field]) {
+			fieldErrors = append(fieldErrors, response.FieldError{
+				Field:      field,
+				Constraint: "immutable",
+				Message:    field + " can not be changed",
+			})
+		}
+	}
+	// Sort the unknown fields so the errors are always in the same order
+	unknown := []string{}
+	for field := range after {
+		if _, ok := before[field]; !ok && !writeOnlyUserFields[field] {
+			unknown = append(unknown, field)
+		}
+	}
+	sort.Strings(unknown)
+	for _, field := range unknown {
+		fieldErrors = append(fieldErrors, response.FieldError{
+			Field:      field,
+			Constraint: "unknown",
+			Message:    field + " is not a field of the user",
+		})
+	}
+	return fieldErrors
+}
@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"ionixx/api/models"
+	"ionixx/api/response"
+	"ionixx/api/storage"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SessionController struct {
+	store *storage.Store
+}
+
+/**
+ * Function to create the session controller
+ */
+func NewSessionController(store *storage.Store) *SessionController {
+	return &SessionController{store: store}
+}
+
+type SessionResponse struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+/**
+ * Function to get all active sessions of the logged in user, also served at /me/sessions
+ * @api {get} /auth/sessions Get all sessions
+ * @apiSuccessExample {json} Success-Response:
+ *   HTTP/1.1 200 OK
+ *  {
+ * 		"success": true,
+ * 		"message": "Sessions fetched successfully!",
+ * 		"data": [
+ * 			{
+ * 				"id": 1,
+ * 				"user_id": 1,
+ * 				"device_name": "Pixel 6",
+ * 				"user_agent": "okhttp/4.9.3",
+ * 				"ip": "127.0.0.1",
+ * 				"last_seen_at": "2020-01-01T00:00:00Z",
+ * 				"expires_at": "2020-01-31T00:00:00Z",
+ * 				"revoked_at": null,
+ * 				"created_at": "2020-01-01T00:00:00Z",
+ * 				"updated_at": "2020-01-01T00:00:00Z",
+ * 				"current": true
+ * 			}
+ * 		]
+ * 	}
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 500 Internal Server Error
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Internal Server Error",
+ * 	"status": 500,
+ * 	"detail": "Internal server error",
+ * 	"instance": "/auth/sessions",
+ * 	"code": "internal_error",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
+ */
+func (s *SessionController) GetSessions(c *gin.Context) {
+	// Find all sessions of the user that are neither revoked nor expired
+	sessions, err := s.store.WithContext(c.Request.Context()).Sessions.ListActive(c.GetUint("userId"))
+	if err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+
+	// Flag the session the request was made with
+	list := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		list = append(list, SessionResponse{
+			Session: session,
+			Current: session.ID == c.GetUint("sessionId"),
+		})
+	}
+
+	// Return a success response with the sessions
+	response.SuccessJSON(c, http.StatusOK, "Sessions fetched successfully!", list)
+}
+
+/**
+ * Function to revoke a session of the logged in user, also served at /me/sessions/:id
+ * @api {delete} /auth/sessions/:id Revoke session by id
+ * @apiSuccessExample {json} Success-Response:
+ * HTTP/1.1 200 OK
+ * {
+ * 	"success": true,
+ * 	"message": "Session revoked successfully!",
+ * 	"data": null
+ * }
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 404 Not Found
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Not Found",
+ * 	"status": 404,
+ * 	"detail": "Session not found",
+ * 	"instance": "/auth/sessions/2",
+ * 	"code": "session_not_found",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
+ */
+func (s *SessionController) RevokeSession(c *gin.Context) {
+	store := s.store.WithContext(c.Request.Context())
+	// Get the session by id, users can only revoke their own sessions
+	id, err := paramID(c)
+	var session *models.Session
+	if err == nil {
+		session, err = store.Sessions.FindByID(id)
+	}
+	if err == nil && session.UserID != c.GetUint("userId") {
+		err = storage.ErrNotFound
+	}
+
+	// If session not found, return not found
+	if err == storage.ErrNotFound {
+		response.ErrorJSON(c, http.StatusNotFound, response.CodeSessionNotFound, "Session not found")
+		return
+	}
+	if err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+
+	// Revoke the session and its refresh tokens
+	if err := store.Sessions.Revoke(session.ID); err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+
+	// Return a success response
+	response.SuccessJSON(c, http.StatusOK, "Session revoked successfully!", nil)
+}
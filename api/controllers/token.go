@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"ionixx/api/config"
+	"ionixx/api/models"
+	"ionixx/api/signing"
+	"ionixx/api/storage"
+	"time"
+)
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+/**
+ * Function to generate a random url safe token
+ */
+func generateOpaqueToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+/**
+ * Function to hash an opaque token before it is stored in the database
+ */
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+/**
+ * Function to issue a new access token and a refresh token for the given session
+ */
+func issueTokens(store *storage.Store, auth config.AuthConfig, keys *signing.KeySet, user *models.User, session *models.Session) (*TokenResponse, error) {
+	// Generate the jwt access token bound to the session
+	accessToken, err := generateToken(auth, keys, *user, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Generate the refresh token
+	refreshToken, err := generateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	// Save only the hash of the refresh token
+	expiresAt := time.Now().Add(auth.RefreshTokenTTL)
+	err = store.Tokens.CreateRefreshToken(&models.RefreshToken{
+		UserID:    user.ID,
+		SessionID: session.ID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The session lives as long as its latest refresh token
+	session.LastSeenAt = time.Now()
+	session.ExpiresAt = expiresAt
+	if err := store.Sessions.Update(session, "last_seen_at", "expires_at"); err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(auth.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+/**
+ * Function to revoke a single access token until it expires
+ */
+func revokeAccessToken(store *storage.Store, claims *models.JwtCustomClaims) error {
+	return store.Tokens.RevokeAccessToken(claims.Id, time.Unix(claims.ExpiresAt, 0))
+}
@@ -1,28 +1,160 @@
 package controllers
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"ionixx/api/config"
 	"ionixx/api/models"
 	"ionixx/api/storage"
 	"net/http"
+	"strconv"
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
-
 	"ionixx/api/response"
 
 	"github.com/gin-gonic/gin"
-
-	"github.com/go-playground/validator/v10"
 )
 
-type UserController struct{}
+type UserController struct {
+	store *storage.Store
+	auth  config.AuthConfig
+}
+
+/**
+ * Function to create the user controller
+ */
+func NewUserController(store *storage.Store, auth config.AuthConfig) *UserController {
+	return &UserController{store: store, auth: auth}
+}
+
+// userIDFunc gets the id of the user a request is about, from the route or the logged in user
+type userIDFunc func(c *gin.Context) (uint, error)
+
+/**
+ * Function to get the user the request is about
+ */
+func (u *UserController) findUser(c *gin.Context, userID userIDFunc) (*models.User, error) {
+	id, err := userID(c)
+	if err != nil {
+		return nil, err
+	}
+	return u.store.WithContext(c.Request.Context()).Users.FindByID(id)
+}
+
+/**
+ * Function to get the id route parameter, ids that can not be parsed are not found
+ */
+func paramID(c *gin.Context) (uint, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		return 0, storage.ErrNotFound
+	}
+	return uint(id), nil
+}
+
+/**
+ * Function to get the id of the logged in user set by the auth middleware
+ */
+func currentUserID(c *gin.Context) (uint, error) {
+	id := c.GetUint("userId")
+	if id == 0 {
+		return 0, storage.ErrNotFound
+	}
+	return id, nil
+}
+
+/**
+ * Function to get the ETag of the user, it changes with every write of the profile or the role of the user
+ */
+func userETag(user *models.User) string {
+	return response.VersionETag(user.ID, user.Version)
+}
+
+/**
+ * Function to check if the logged in user can see the email, role, mfa and lockout state of the user:
+ * only the user themself and admins can
+ */
+func canSeePrivateFields(c *gin.Context, user *models.User) bool {
+	return c.GetString("role") == models.RoleAdmin || (user != nil && c.GetUint("userId") == user.ID)
+}
+
+/**
+ * Function to get the profiles of the users shown to other users
+ */
+func publicUsers(users []models.User) []models.PublicUser {
+	profiles := make([]models.PublicUser, 0, len(users))
+	for _, user := range users {
+		profiles = append(profiles, user.Public())
+	}
+	return profiles
+}
+
+/**
+ * Function to get the search results shown to other users
+ */
+func publicSearchResults(results []models.UserSearchResult) []models.PublicUserSearchResult {
+	profiles := make([]models.PublicUserSearchResult, 0, len(results))
+	for _, result := range results {
+		profiles = append(profiles, result.Public())
+	}
+	return profiles
+}
+
+type ListUsersQuery struct {
+	Limit       int       `form:"limit" binding:"omitempty,min=1,max=100"`
+	Offset      int       `form:"offset" binding:"omitempty,min=0"`
+	Cursor      string    `form:"cursor"`
+	Sort        string    `form:"sort"`
+	UserName    string    `form:"user_name"`
+	FullName    string    `form:"full_name"`
+	DobFrom     time.Time `form:"dob_from" time_format:"2006-01-02"`
+	DobTo       time.Time `form:"dob_to" time_format:"2006-01-02"`
+	CreatedFrom time.Time `form:"created_from"`
+	CreatedTo   time.Time `form:"created_to"`
+}
+
+/**
+ * Function to convert the list query to the user query of the store
+ */
+func (q *ListUsersQuery) toUserQuery(sort pageSort) storage.UserQuery {
+	query := storage.UserQuery{
+		UserName:    q.UserName,
+		FullName:    q.FullName,
+		DobFrom:     q.DobFrom,
+		CreatedFrom: q.CreatedFrom,
+		CreatedTo:   q.CreatedTo,
+		Sort:        sort.Field,
+		Desc:        sort.Desc,
+		Offset:      q.Offset,
+		// Fetch one more user than the limit to know if there is a next page
+		Limit: q.Limit + 1,
+	}
+	if !q.DobTo.IsZero() {
+		// The range includes the whole last day
+		query.DobBefore = q.DobTo.AddDate(0, 0, 1)
+	}
+	return query
+}
 
 /**
- * Function to get all users
+ * Function to get all users, a page at a time. The list is public, it never has the email, role, mfa and lockout
+ * state of the users, admins get them from the user by id
  * @api {get} /users/ Get all users
+ * @apiParam {Number} [limit=20] Number of users in the page, at most 100
+ * @apiParam {Number} [offset=0] Number of users to skip, ignored when a cursor is given
+ * @apiParam {String} [cursor] The next_cursor of the previous page
+ * @apiParam {String} [sort=id] One of id, user_name, full_name, dob, created_at, updated_at, prefixed with - for descending order
+ * @apiParam {String} [user_name] Users whose user name contains the value
+ * @apiParam {String} [full_name] Users whose full name contains the value
+ * @apiParam {String} [dob_from] Users born on or after the date, as YYYY-MM-DD
+ * @apiParam {String} [dob_to] Users born on or before the date, as YYYY-MM-DD
+ * @apiParam {String} [created_from] Users created at or after the RFC 3339 time
+ * @apiParam {String} [created_to] Users created at or before the RFC 3339 time
+ * @apiHeader {String} [If-None-Match] ETag the client has, answered with 304 Not Modified when it is still current
  * @apiSuccessExample {json} Success-Response:
  *    HTTP/1.1 200 OK
+ * ETag: "9b1d4f0e2c7a6b8e3d5f1a0c4e2b7d9f"
  *   {
  *    	"success": true,
  *   	"message": "Users fetched successfully!",
@@ -36,36 +168,173 @@ type UserController struct{}
  * 				"created_at": "2020-01-01T00:00:00Z",
  * 				"updated_at": "2020-01-01T00:00:00Z"
  *  		},
- *		]
+ *		],
+ * 		"meta": {
+ * 			"total": 42,
+ * 			"limit": 20,
+ * 			"offset": 0,
+ * 			"next_cursor": "eyJzIjoiaWQiLCJ2IjpudWxsLCJpZCI6MjB9"
+ * 		}
  *   }
  * @apiErrorExample {json} Error-Response:
- *   HTTP/1.1 400 Bad Request
- *  {
- *  	"success": false,
- * 		"message": "Error fetching users!",
- * 		"data": null
- * 	}
+ * HTTP/1.1 400 Bad Request
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Bad Request",
+ * 	"status": 400,
+ * 	"detail": "Invalid cursor",
+ * 	"instance": "/user/",
+ * 	"code": "invalid_cursor",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
  */
 func (u *UserController) GetAllUsers(c *gin.Context) {
-	var list []models.User
-	// Find all users in the database
-	result := storage.DB.Find(&list)
+	var listQuery ListUsersQuery
+	// Bind the query string to the list query
+	if err := c.ShouldBindQuery(&listQuery); err != nil {
+		response.BindErrorJSON(c, err)
+		return
+	}
+	if listQuery.Limit == 0 {
+		listQuery.Limit = defaultPageLimit
+	}
 
-	if result.Error != nil {
-		// If there is an error, we return a bad request
-		response.ErrorJSON(c, http.StatusInternalServerError, result.Error.Error())
+	// Only whitelisted columns can be sorted by
+	sort, err := parseSort(listQuery.Sort)
+	if err != nil {
+		response.ErrorJSON(c, http.StatusBadRequest, response.CodeInvalidSort, err.Error())
 		return
 	}
 
-	// Return a success response with the users
-	response.SuccessJSON(c, http.StatusOK, "Users fetched successfully!", list)
+	// Start after the cursor, the offset is ignored when there is a cursor
+	if listQuery.Cursor != "" {
+		listQuery.Offset = 0
+	}
+	query := listQuery.toUserQuery(sort)
+	if listQuery.Cursor != "" {
+		if query.After, err = sort.DecodeCursor(listQuery.Cursor); err != nil {
+			response.ErrorJSON(c, http.StatusBadRequest, response.CodeInvalidCursor, err.Error())
+			return
+		}
+	}
+
+	// Get the page of users and the number of users matching the filters
+	list, total, err := u.store.WithContext(c.Request.Context()).Users.List(query)
+	if err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+
+	meta := response.PageMeta{Total: total, Limit: listQuery.Limit, Offset: listQuery.Offset}
+	if len(list) > listQuery.Limit {
+		list = list[:listQuery.Limit]
+		meta.NextCursor = sort.EncodeCursor(list[len(list)-1])
+	}
+
+	// The list is served without authentication, it only has the profiles of the users
+	data := publicUsers(list)
+
+	// The page is not sent again when the client has it already
+	etag, err := response.HashETag(gin.H{"data": data, "meta": meta})
+	if err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+	if response.NotModified(c, etag) {
+		return
+	}
+
+	// Return a success response with the page of users
+	response.SuccessJSONWithMeta(c, http.StatusOK, "Users fetched successfully!", data, meta)
+}
+
+type SearchUsersQuery struct {
+	Q     string `form:"q" binding:"required"`
+	Limit int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+/**
+ * Function to search users by full name, user name and linkedin url, the best matches come first.
+ * Only admins get the email, role, mfa and lockout state of the users.
+ * The matched words are wrapped in <mark> tags in the highlight, the rest of the fields is html escaped.
+ * @api {get} /users/search Search users
+ * @apiParam {String} q The search, partial and misspelled names match too
+ * @apiParam {Number} [limit=20] Number of users returned, at most 100
+ * @apiSuccessExample {json} Success-Response:
+ *    HTTP/1.1 200 OK
+ *   {
+ *    	"success": true,
+ *   	"message": "Users fetched successfully!",
+ *  	"data": [
+ *   		{
+ *   			"id": 1,
+ *  			"user_name": "test",
+ *				"full_name": "Test User",
+ * 				"dob": "2020-01-01T00:00:00Z",
+ * 				"linkedin_url": "",
+ * 				"created_at": "2020-01-01T00:00:00Z",
+ * 				"updated_at": "2020-01-01T00:00:00Z",
+ * 				"rank": 1.06,
+ * 				"highlight": {
+ * 					"full_name": "<mark>Test</mark> User",
+ * 					"user_name": "<mark>test</mark>",
+ * 					"linkedin_url": ""
+ * 				}
+ *  		},
+ *		]
+ *   }
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 422 Unprocessable Entity
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Unprocessable Entity",
+ * 	"status": 422,
+ * 	"detail": "The request has invalid fields",
+ * 	"instance": "/user/search",
+ * 	"code": "validation_failed",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f",
+ * 	"errors": [
+ * 		{"field": "q", "constraint": "required", "message": "q is a required field"}
+ * 	]
+ * }
+ */
+func (u *UserController) SearchUsers(c *gin.Context) {
+	var searchQuery SearchUsersQuery
+	// Bind the query string to the search query
+	if err := c.ShouldBindQuery(&searchQuery); err != nil {
+		response.BindErrorJSON(c, err)
+		return
+	}
+	if searchQuery.Limit == 0 {
+		searchQuery.Limit = defaultPageLimit
+	}
+
+	// Search the users, ranked by relevance
+	results, err := u.store.WithContext(c.Request.Context()).Users.Search(searchQuery.Q, searchQuery.Limit)
+	if err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+
+	// Only admins see the private fields of every user
+	if canSeePrivateFields(c, nil) {
+		response.SuccessJSON(c, http.StatusOK, "Users fetched successfully!", results)
+		return
+	}
+
+	// Return a success response with the matching users
+	response.SuccessJSON(c, http.StatusOK, "Users fetched successfully!", publicSearchResults(results))
 }
 
 /**
- * Function to get user by id
+ * Function to get user by id, only the user themself and admins get the email, role, mfa and lockout state
  * @api {get} /users/:id Get user by id
+ * @apiHeader {String} [If-None-Match] ETag the client has, answered with 304 Not Modified when it is still current
  * @apiSuccessExample {json} Success-Response:
  *   HTTP/1.1 200 OK
+ * ETag: "1-3"
  *  {
  * 		"success": true,
  * 		"message": "User fetched successfully!",
@@ -73,28 +342,51 @@ func (u *UserController) GetAllUsers(c *gin.Context) {
  * 			"id": 1,
  * 			"user_name": "test",
  * 			"full_name": "Test User",
+ * 			"email": "test@example.com",
  * 			"dob": "2020-01-01T00:00:00Z",
  * 			"linkedin_url": "",
+ * 			"role": "member",
  * 			"created_at": "2020-01-01T00:00:00Z",
  * 			"updated_at": "2020-01-01T00:00:00Z"
  * 		}
  * 	}
  * @apiErrorExample {json} Error-Response:
- *  HTTP/1.1 400 Bad Request
- * 	{
- * 		"success": false,
- * 		"message": "Error fetching user!",
- * 		"data": null
- * 	}
+ * HTTP/1.1 404 Not Found
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Not Found",
+ * 	"status": 404,
+ * 	"detail": "User not found",
+ * 	"instance": "/user/42",
+ * 	"code": "user_not_found",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
  */
 func (u *UserController) GetUserByID(c *gin.Context) {
-	var user models.User
-	// Get the first user with the id
-	result := storage.DB.Where("id = ?", c.Param("id")).First(&user)
+	u.getUser(c, paramID)
+}
 
-	if result.Error != nil {
-		// If there is an error, we return a bad request
-		response.ErrorJSON(c, http.StatusBadRequest, result.Error.Error())
+/**
+ * Function to respond with the user of the id
+ */
+func (u *UserController) getUser(c *gin.Context, userID userIDFunc) {
+	// Get the user with the id
+	user, err := u.findUser(c, userID)
+	if err != nil {
+		// Missing users are not found, other errors are internal
+		userErrorJSON(c, err)
+		return
+	}
+	// The fields sent depend on who asks
+	c.Header("Vary", "Authorization")
+	// The user is not sent again when the client has it already
+	if response.NotModified(c, userETag(user)) {
+		return
+	}
+	// Other members only see the profile of the user
+	if !canSeePrivateFields(c, user) {
+		response.SuccessJSON(c, http.StatusOK, "User fetched successfully!", user.Public())
 		return
 	}
 	// Return a success response with the user
@@ -105,25 +397,28 @@ type CreateUserRequest struct {
 	UserName    string    `json:"user_name" binding:"required,min=3"`
 	Password    string    `json:"password" binding:"required,min=6"`
 	FullName    string    `json:"full_name" binding:"required"`
+	Email       string    `json:"email" binding:"omitempty,email"`
 	Dob         time.Time `json:"dob" binding:"required"`
 	LinkedinURL string    `json:"linkedin_url" binding:"required"`
 }
 
 /**
- * Function to convert a CreateUserRequest to a User
+ * Function to convert a CreateUserRequest to a User, the password is hashed at the given cost
  */
-func (c *CreateUserRequest) toUser() (*models.User, error) {
+func (c *CreateUserRequest) toUser(ctx context.Context, bcryptCost int) (*models.User, error) {
 	// Generate hashed password
-	hashedPasswordBytes, err := bcrypt.GenerateFromPassword([]byte(c.Password), 14)
+	hashedPassword, err := hashPassword(ctx, c.Password, bcryptCost)
 	if err != nil {
 		return nil, err
 	}
 	return &models.User{
 		UserName:    c.UserName,
-		Password:    string(hashedPasswordBytes),
+		Password:    hashedPassword,
 		FullName:    c.FullName,
+		Email:       c.Email,
 		Dob:         &c.Dob,
 		LinkedinURL: c.LinkedinURL,
+		Role:        models.RoleMember,
 	}, nil
 }
 
@@ -139,46 +434,83 @@ func (c *CreateUserRequest) toUser() (*models.User, error) {
  * 		"id": 1,
  * 		"user_name": "test",
  * 		"full_name": "Test User",
+ * 		"email": "test@example.com",
  * 		"dob": "2020-01-01T00:00:00Z",
  * 		"linkedin_url": "",
+ * 		"role": "member",
  * 		"created_at": "2020-01-01T00:00:00Z",
  * 		"updated_at": "2020-01-01T00:00:00Z"
  * 	}
  * }
  * @apiErrorExample {json} Error-Response:
- * HTTP/1.1 400 Bad Request
+ * HTTP/1.1 422 Unprocessable Entity
+ * Content-Type: application/problem+json
  * {
- * 	"success": false,
- * 	"message": "Error creating user!",
- * 	"data": null
+ * 	"type": "about:blank",
+ * 	"title": "Unprocessable Entity",
+ * 	"status": 422,
+ * 	"detail": "The request has invalid fields",
+ * 	"instance": "/user/",
+ * 	"code": "validation_failed",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f",
+ * 	"errors": [
+ * 		{"field": "password", "constraint": "min", "param": "6", "message": "password must be at least 6 characters in length"},
+ * 		{"field": "dob", "constraint": "required", "message": "dob is a required field"}
+ * 	]
+ * }
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 409 Conflict
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Conflict",
+ * 	"status": 409,
+ * 	"detail": "The user name test is already taken",
+ * 	"instance": "/user/",
+ * 	"code": "user_name_taken",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 409 Conflict
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Conflict",
+ * 	"status": 409,
+ * 	"detail": "The email is already taken",
+ * 	"instance": "/user/",
+ * 	"code": "email_taken",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
  * }
  */
 func (u *UserController) CreateUser(c *gin.Context) {
 	var userData CreateUserRequest
 	// Bind the request body to the user data
 	if err := c.ShouldBindJSON(&userData); err != nil {
-		// Return the first validation error
-		for _, fieldErr := range err.(validator.ValidationErrors) {
-			response.ErrorJSON(c, http.StatusBadRequest, fmt.Sprintf("Validation Error : %s %s", fieldErr.Field(), fieldErr.Tag()))
-			return
-		}
+		// Return every field failing validation
+		response.BindErrorJSON(c, err)
 		return
 	}
 
 	// Create the user model
-	user, userErr := userData.toUser()
-	// If there is an error, we return a bad request
+	user, userErr := userData.toUser(c.Request.Context(), u.auth.BcryptCost)
 	if userErr != nil {
-		response.ErrorJSON(c, http.StatusBadRequest, userErr.Error())
+		internalErrorJSON(c, userErr)
 		return
 	}
 
-	// Save the user to the database
-	result := storage.DB.Create(user)
-
-	// If there is an error, we return a bad request
-	if result.Error != nil {
-		response.ErrorJSON(c, http.StatusBadRequest, result.Error.Error())
+	// Save the user to the store
+	if err := u.store.WithContext(c.Request.Context()).Users.Create(user); err != nil {
+		// The user name and the email are unique
+		if errors.Is(err, storage.ErrEmailTaken) {
+			response.ErrorJSON(c, http.StatusConflict, response.CodeEmailTaken, "The email is already taken")
+			return
+		}
+		if errors.Is(err, storage.ErrDuplicate) {
+			response.ErrorJSON(c, http.StatusConflict, response.CodeUserNameTaken, fmt.Sprintf("The user name %s is already taken", user.UserName))
+			return
+		}
+		internalErrorJSON(c, err)
 		return
 	}
 
@@ -189,15 +521,36 @@ func (u *UserController) CreateUser(c *gin.Context) {
 
 type UpdateUserRequest struct {
 	FullName    string    `json:"full_name"`
+	Email       string    `json:"email" binding:"omitempty,email"`
 	Dob         time.Time `json:"dob"`
 	LinkedinURL string    `json:"linkedin_url"`
+	// CurrentPassword is required when users change their own email
+	CurrentPassword string `json:"current_password"`
+}
+
+/**
+ * Function to check the current password before users change their own email, the password reset mail goes to it.
+ * Admins change the email of other users without it. The problem is sent and false returned when the password is wrong
+ */
+func checkEmailChange(c *gin.Context, user *models.User, email string, currentPassword string) bool {
+	if email == user.Email || c.GetUint("userId") != user.ID {
+		return true
+	}
+	if err := comparePassword(c.Request.Context(), user.Password, currentPassword); err != nil {
+		response.ErrorJSON(c, http.StatusBadRequest, response.CodeWrongCurrentPassword, "The current password is required to change the email")
+		return false
+	}
+	return true
 }
 
 /**
  * Function to update user by id
  * @api {put} /users/:id Update user by id
+ * @apiHeader {String} [If-Match] ETag the user was read with, the write fails with 412 when the user changed since
+ * @apiParam {String} [current_password] Password of the user, required when users change their own email
  * @apiSuccessExample {json} Success-Response:
  * HTTP/1.1 200 OK
+ * ETag: "1-4"
  * {
  * 	"success": true,
  * 	"message": "User updated successfully!",
@@ -205,35 +558,75 @@ type UpdateUserRequest struct {
  * 		"id": 1,
  * 		"user_name": "test",
  * 		"full_name": "Test User",
+ * 		"email": "test@example.com",
  * 		"dob": "2020-01-01T00:00:00Z",
  * 		"linkedin_url": "",
+ * 		"role": "member",
  * 		"created_at": "2020-01-01T00:00:00Z",
  * 		"updated_at": "2020-01-01T00:00:00Z"
  * 	}
  * }
  * @apiErrorExample {json} Error-Response:
- * HTTP/1.1 400 Bad Request
+ * HTTP/1.1 404 Not Found
+ * Content-Type: application/problem+json
  * {
- * 	"success": false,
- * 	"message": "Error updating user!",
- * 	"data": null
+ * 	"type": "about:blank",
+ * 	"title": "Not Found",
+ * 	"status": 404,
+ * 	"detail": "User not found",
+ * 	"instance": "/user/42",
+ * 	"code": "user_not_found",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 412 Precondition Failed
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Precondition Failed",
+ * 	"status": 412,
+ * 	"detail": "The resource was changed since it was read, get it again",
+ * 	"instance": "/user/1",
+ * 	"code": "precondition_failed",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 409 Conflict
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Conflict",
+ * 	"status": 409,
+ * 	"detail": "The email is already taken",
+ * 	"instance": "/user/1",
+ * 	"code": "email_taken",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
  * }
- *
  */
 func (u *UserController) UpdateUserById(c *gin.Context) {
+	u.updateUser(c, paramID)
+}
+
+/**
+ * Function to update the user of the id with the fields of the request
+ */
+func (u *UserController) updateUser(c *gin.Context, userID userIDFunc) {
 	var userData UpdateUserRequest
 	// Bind the request body to the user data
-	if err := c.BindJSON(&userData); err != nil {
-		response.ErrorJSON(c, http.StatusBadRequest, err.Error())
+	if err := c.ShouldBindJSON(&userData); err != nil {
+		response.BindErrorJSON(c, err)
 		return
 	}
 	// Get the user by id
-	user := models.User{}
-	result := storage.DB.Where("id = ?", c.Param("id")).First(&user)
+	user, err := u.findUser(c, userID)
 
-	// If user not found, return a bad request
-	if result.Error != nil {
-		response.ErrorJSON(c, http.StatusBadRequest, result.Error.Error())
+	// If user not found, return not found
+	if err != nil {
+		userErrorJSON(c, err)
+		return
+	}
+	// The update is refused when the user changed since the client read it
+	if !response.IfMatch(c, userETag(user)) {
 		return
 	}
 
@@ -242,6 +635,14 @@ func (u *UserController) UpdateUserById(c *gin.Context) {
 		user.FullName = userData.FullName
 	}
 
+	// If Email is provided, update the user once the owner confirmed it with their password
+	if userData.Email != "" {
+		if !checkEmailChange(c, user, userData.Email, userData.CurrentPassword) {
+			return
+		}
+		user.Email = userData.Email
+	}
+
 	// If Dob is provided, update the user
 	if userData.Dob != (time.Time{}) {
 		user.Dob = &userData.Dob
@@ -252,22 +653,154 @@ func (u *UserController) UpdateUserById(c *gin.Context) {
 		user.LinkedinURL = userData.LinkedinURL
 	}
 
-	// Save the user updates to the database
-	result = storage.DB.Save(&user)
-
-	// If there is an error, we return a bad request
-	if result.Error != nil {
-		response.ErrorJSON(c, http.StatusBadRequest, result.Error.Error())
+	// Save the user updates to the store, unless another request changed the user in between
+	if err := u.store.WithContext(c.Request.Context()).Users.UpdateIfVersion(user, "full_name", "email", "dob", "linkedin_url"); err != nil {
+		userWriteErrorJSON(c, err)
 		return
 	}
+	c.Header("ETag", userETag(user))
 
 	// Return a success response with the updated user
-	response.SuccessJSON(c, http.StatusOK, "User updated successfully!", &user)
+	response.SuccessJSON(c, http.StatusOK, "User updated successfully!", user)
+}
+
+/**
+ * Function to patch user by id with a JSON Merge Patch or a JSON Patch, null and removed fields are cleared.
+ * The id, user name and timestamps can not be patched
+ * @api {patch} /users/:id Patch user by id
+ * @apiHeader {String} [If-Match] ETag the user was read with, the write fails with 412 when the user changed since
+ * @apiParam {String} [current_password] Member of the patch with the password of the user, required when users change their own email
+ * @apiParamExample {json} Merge-Patch:
+ * Content-Type: application/merge-patch+json
+ * {
+ * 	"full_name": "Test User",
+ * 	"linkedin_url": null
+ * }
+ * @apiParamExample {json} JSON-Patch:
+ * Content-Type: application/json-patch+json
+ * [
+ * 	{"op": "replace", "path": "/full_name", "value": "Test User"},
+ * 	{"op": "remove", "path": "/dob"}
+ * ]
+ * @apiSuccessExample {json} Success-Response:
+ * HTTP/1.1 200 OK
+ * ETag: "1-4"
+ * {
+ * 	"success": true,
+ * 	"message": "User updated successfully!",
+ * 	"data": {
+ * 		"id": 1,
+ * 		"user_name": "test",
+ * 		"full_name": "Test User",
+ * 		"email": "test@example.com",
+ * 		"dob": null,
+ * 		"linkedin_url": "",
+ * 		"role": "member",
+ * 		"created_at": "2020-01-01T00:00:00Z",
+ * 		"updated_at": "2020-01-01T00:00:00Z"
+ * 	}
+ * }
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 422 Unprocessable Entity
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Unprocessable Entity",
+ * 	"status": 422,
+ * 	"detail": "The request has invalid fields",
+ * 	"instance": "/user/1",
+ * 	"code": "validation_failed",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f",
+ * 	"errors": [
+ * 		{"field": "user_name", "constraint": "immutable", "message": "user_name can not be changed"}
+ * 	]
+ * }
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 415 Unsupported Media Type
+ * Accept-Patch: application/merge-patch+json, application/json-patch+json
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Unsupported Media Type",
+ * 	"status": 415,
+ * 	"detail": "The patch must be application/merge-patch+json or application/json-patch+json",
+ * 	"instance": "/user/1",
+ * 	"code": "unsupported_media_type",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 412 Precondition Failed
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Precondition Failed",
+ * 	"status": 412,
+ * 	"detail": "The resource was changed since it was read, get it again",
+ * 	"instance": "/user/1",
+ * 	"code": "precondition_failed",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 409 Conflict
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Conflict",
+ * 	"status": 409,
+ * 	"detail": "The email is already taken",
+ * 	"instance": "/user/1",
+ * 	"code": "email_taken",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
+ */
+func (u *UserController) PatchUserById(c *gin.Context) {
+	u.patchUser(c, paramID)
+}
+
+/**
+ * Function to patch the user of the id with the patch of the request
+ */
+func (u *UserController) patchUser(c *gin.Context, userID userIDFunc) {
+	// Get the user by id
+	user, err := u.findUser(c, userID)
+	if err != nil {
+		userErrorJSON(c, err)
+		return
+	}
+	// The patch is refused when the user changed since the client read it
+	if !response.IfMatch(c, userETag(user)) {
+		return
+	}
+
+	// Apply the patch, the problem is already sent when it fails
+	patchRequest, ok := patchUserRequest(c, user)
+	if !ok {
+		return
+	}
+	// The owner confirms a new email with their password
+	if !checkEmailChange(c, user, patchRequest.Email, patchRequest.CurrentPassword) {
+		return
+	}
+	user.FullName = patchRequest.FullName
+	user.Email = patchRequest.Email
+	user.Dob = patchRequest.Dob
+	user.LinkedinURL = patchRequest.LinkedinURL
+
+	// Save every patchable field, the cleared ones included, unless another request changed the user in between
+	if err := u.store.WithContext(c.Request.Context()).Users.UpdateIfVersion(user, "full_name", "email", "dob", "linkedin_url"); err != nil {
+		userWriteErrorJSON(c, err)
+		return
+	}
+	c.Header("ETag", userETag(user))
+
+	// Return a success response with the patched user
+	response.SuccessJSON(c, http.StatusOK, "User updated successfully!", user)
 }
 
 /**
  * Function to delete user by id
  * @api {delete} /users/:id Delete user by id
+ * @apiHeader {String} [If-Match] ETag the user was read with, the write fails with 412 when the user changed since
  * @apiSuccessExample {json} Success-Response:
  * HTTP/1.1 200 OK
  * {
@@ -276,31 +809,207 @@ func (u *UserController) UpdateUserById(c *gin.Context) {
  * 	"data": null
  * }
  * @apiErrorExample {json} Error-Response:
- * HTTP/1.1 400 Bad Request
+ * HTTP/1.1 404 Not Found
+ * Content-Type: application/problem+json
  * {
- * 	"success": false,
- * 	"message": "Error deleting user!",
- * 	"data": null
+ * 	"type": "about:blank",
+ * 	"title": "Not Found",
+ * 	"status": 404,
+ * 	"detail": "User not found",
+ * 	"instance": "/user/42",
+ * 	"code": "user_not_found",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 412 Precondition Failed
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Precondition Failed",
+ * 	"status": 412,
+ * 	"detail": "The resource was changed since it was read, get it again",
+ * 	"instance": "/user/1",
+ * 	"code": "precondition_failed",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
  * }
  */
 func (u *UserController) DeleteUserById(c *gin.Context) {
-	user := models.User{}
+	u.deleteUser(c, paramID)
+}
+
+/**
+ * Function to delete the user of the id and logout all of their sessions
+ */
+func (u *UserController) deleteUser(c *gin.Context, userID userIDFunc) {
+	store := u.store.WithContext(c.Request.Context())
 	// Get the user by id
-	result := storage.DB.Where("id = ?", c.Param("id")).First(&user)
-	// If user not found, return a bad request
-	if result.Error != nil {
-		response.ErrorJSON(c, http.StatusBadRequest, result.Error.Error())
+	user, err := u.findUser(c, userID)
+	// If user not found, return not found
+	if err != nil {
+		userErrorJSON(c, err)
+		return
+	}
+	// The delete is refused when the user changed since the client read it
+	if !response.IfMatch(c, userETag(user)) {
+		return
+	}
+	// Soft delete the user, unless another request changed the user in between
+	if err := store.Users.DeleteIfVersion(user.ID, user.Version); err != nil {
+		userWriteErrorJSON(c, err)
 		return
 	}
-	// Soft delete the user
-	result = storage.DB.Delete(&user)
 
-	// If there is an error, we return a bad request
-	if result.Error != nil {
-		response.ErrorJSON(c, http.StatusBadRequest, result.Error.Error())
+	// Revoke every session of the deleted user
+	if err := store.Sessions.RevokeAll(user.ID, 0); err != nil {
+		internalErrorJSON(c, err)
 		return
 	}
 
 	// Return a success response
 	response.SuccessJSON(c, http.StatusOK, "User deleted successfully!", nil)
 }
+
+type UpdateUserRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=admin member"`
+}
+
+/**
+ * Function to update the role of a user by id
+ * @api {put} /users/:id/role Update user role by id
+ * @apiSuccessExample {json} Success-Response:
+ * HTTP/1.1 200 OK
+ * {
+ * 	"success": true,
+ * 	"message": "User role updated successfully!",
+ * 	"data": {
+ * 		"id": 1,
+ * 		"user_name": "test",
+ * 		"full_name": "Test User",
+ * 		"email": "test@example.com",
+ * 		"dob": "2020-01-01T00:00:00Z",
+ * 		"linkedin_url": "",
+ * 		"role": "admin",
+ * 		"created_at": "2020-01-01T00:00:00Z",
+ * 		"updated_at": "2020-01-01T00:00:00Z"
+ * 	}
+ * }
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 422 Unprocessable Entity
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Unprocessable Entity",
+ * 	"status": 422,
+ * 	"detail": "The request has invalid fields",
+ * 	"instance": "/user/42/role",
+ * 	"code": "validation_failed",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f",
+ * 	"errors": [
+ * 		{"field": "role", "constraint": "oneof", "param": "admin member", "message": "role must be one of [admin member]"}
+ * 	]
+ * }
+ */
+func (u *UserController) UpdateUserRole(c *gin.Context) {
+	store := u.store.WithContext(c.Request.Context())
+	var roleData UpdateUserRoleRequest
+	// Bind the request body to the role data
+	if err := c.ShouldBindJSON(&roleData); err != nil {
+		response.BindErrorJSON(c, err)
+		return
+	}
+	// Get the user by id
+	user, err := u.findUser(c, paramID)
+
+	// If user not found, return not found
+	if err != nil {
+		userErrorJSON(c, err)
+		return
+	}
+
+	// Save the new role to the store
+	if err := setUserRole(store, user, roleData.Role); err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+
+	// Return a success response with the updated user
+	response.SuccessJSON(c, http.StatusOK, "User role updated successfully!", user)
+}
+
+/**
+ * Function to give a user the admin role by user name. Only admins can change roles through the api,
+ * so the first admin of a deployment is promoted with this function by the promote subcommand
+ */
+func PromoteToAdmin(store *storage.Store, userName string) (*models.User, error) {
+	user, err := store.Users.FindByUserName(userName)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role == models.RoleAdmin {
+		return user, nil
+	}
+	if err := setUserRole(store, user, models.RoleAdmin); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+/**
+ * Function to save the role of a user, the sessions of the user are revoked so the role in their tokens is not stale
+ */
+func setUserRole(store *storage.Store, user *models.User, role string) error {
+	user.Role = role
+	// The role is part of the user a client reads, it gets a new version
+	if err := store.Users.UpdateIfVersion(user, "role"); err != nil {
+		return err
+	}
+	return store.Sessions.RevokeAll(user.ID, 0)
+}
+
+/**
+ * Function to unlock a user locked by failed logins
+ * @api {post} /users/:id/unlock Unlock user by id
+ * @apiSuccessExample {json} Success-Response:
+ * HTTP/1.1 200 OK
+ * {
+ * 	"success": true,
+ * 	"message": "User unlocked successfully!",
+ * 	"data": {
+ * 		"id": 1,
+ * 		"user_name": "test",
+ * 		"failed_login_attempts": 0,
+ * 		"locked_until": null
+ * 	}
+ * }
+ * @apiErrorExample {json} Error-Response:
+ * HTTP/1.1 404 Not Found
+ * Content-Type: application/problem+json
+ * {
+ * 	"type": "about:blank",
+ * 	"title": "Not Found",
+ * 	"status": 404,
+ * 	"detail": "User not found",
+ * 	"instance": "/user/42/unlock",
+ * 	"code": "user_not_found",
+ * 	"request_id": "4f9c2a1e8b7d4c3a9e1f0b2d6c8a7e5f"
+ * }
+ */
+func (u *UserController) UnlockUser(c *gin.Context) {
+	// Get the user by id
+	user, err := u.findUser(c, paramID)
+
+	// If user not found, return not found
+	if err != nil {
+		userErrorJSON(c, err)
+		return
+	}
+
+	// Reset the failed logins and the lockout
+	if err := clearFailedLogins(u.store.WithContext(c.Request.Context()), user); err != nil {
+		internalErrorJSON(c, err)
+		return
+	}
+
+	// Return a success response with the unlocked user
+	response.SuccessJSON(c, http.StatusOK, "User unlocked successfully!", user)
+}
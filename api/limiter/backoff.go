@@ -0,0 +1,122 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// Backoff tracks failed attempts per key and blocks the key with an exponentially growing delay
+type Backoff struct {
+	// Number of failures after which the key is blocked
+	Threshold int
+	// Delay once the threshold is reached, doubled on every further failure
+	BaseDelay time.Duration
+	// Upper bound of the delay
+	MaxDelay time.Duration
+	// Failures are forgotten when the key has not failed for this long
+	ResetAfter time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]*entry
+	lastSweep time.Time
+}
+
+type entry struct {
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+}
+
+/**
+ * Function to create a backoff limiter
+ */
+func NewBackoff(threshold int, baseDelay time.Duration, maxDelay time.Duration, resetAfter time.Duration) *Backoff {
+	return &Backoff{
+		Threshold:  threshold,
+		BaseDelay:  baseDelay,
+		MaxDelay:   maxDelay,
+		ResetAfter: resetAfter,
+		entries:    map[string]*entry{},
+	}
+}
+
+/**
+ * Function to calculate the delay after the given number of failures, zero while below the threshold
+ */
+func Delay(failures int, threshold int, baseDelay time.Duration, maxDelay time.Duration) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+	delay := baseDelay
+	for i := threshold; i < failures; i++ {
+		delay *= 2
+		if delay >= maxDelay {
+			return maxDelay
+		}
+	}
+	return delay
+}
+
+/**
+ * Function to check if the key may attempt now, otherwise returns how long to wait
+ */
+func (b *Backoff) Allow(key string) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e, ok := b.entries[key]
+	if !ok {
+		return 0, true
+	}
+	if wait := time.Until(e.blockedUntil); wait > 0 {
+		return wait, false
+	}
+	return 0, true
+}
+
+/**
+ * Function to record a failed attempt of the key
+ */
+func (b *Backoff) Failure(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.forgetStale(now)
+
+	e, ok := b.entries[key]
+	if !ok || now.Sub(e.lastFailure) > b.ResetAfter {
+		e = &entry{}
+		b.entries[key] = e
+	}
+	e.failures++
+	e.lastFailure = now
+	if delay := Delay(e.failures, b.Threshold, b.BaseDelay, b.MaxDelay); delay > 0 {
+		e.blockedUntil = now.Add(delay)
+	}
+}
+
+/**
+ * Function to forget the failures of the key
+ */
+func (b *Backoff) Reset(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.entries, key)
+}
+
+/**
+ * Function to drop keys that have not failed recently so the map does not grow forever
+ */
+func (b *Backoff) forgetStale(now time.Time) {
+	// Sweep at most once a minute to keep failures cheap
+	if now.Sub(b.lastSweep) < time.Minute {
+		return
+	}
+	b.lastSweep = now
+	for key, e := range b.entries {
+		if now.Sub(e.lastFailure) > b.ResetAfter && now.After(e.blockedUntil) {
+			delete(b.entries, key)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// Statements slower than this are logged as warnings
+const slowStatement = 200 * time.Millisecond
+
+// gormLogger writes the gorm logs to the request logger of the statement context
+type gormLogger struct {
+	logger *slog.Logger
+}
+
+/**
+ * Function to get the gorm logger writing to the logger, failed statements are errors, slow statements warnings
+ * and every other statement is logged at debug level. Statements are logged with placeholders, never with their values
+ */
+func GormLogger(logger *slog.Logger) gormlogger.Interface {
+	return &gormLogger{logger: logger}
+}
+
+/**
+ * Function to get the logger of the statement, the request logger when the statement runs for a request
+ */
+func (l *gormLogger) from(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return l.logger
+}
+
+/**
+ * Function to set the level of the logger, the level of the slog logger is used instead
+ */
+func (l *gormLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface {
+	return l
+}
+
+func (l *gormLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	l.from(ctx).InfoContext(ctx, fmt.Sprintf(msg, data...))
+}
+
+func (l *gormLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	l.from(ctx).WarnContext(ctx, fmt.Sprintf(msg, data...))
+}
+
+func (l *gormLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	l.from(ctx).ErrorContext(ctx, fmt.Sprintf(msg, data...))
+}
+
+/**
+ * Function to log a statement once it ran
+ */
+func (l *gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	logger := l.from(ctx)
+	elapsed := time.Since(begin)
+	level := slog.LevelDebug
+	message := "sql"
+	switch {
+	// A missing record is an answer, not a failure
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		level, message = slog.LevelError, "sql failed"
+	case elapsed > slowStatement:
+		level, message = slog.LevelWarn, "slow sql"
+	}
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+
+	sql, rows := fc()
+	attrs := []slog.Attr{
+		slog.String("sql", sql),
+		slog.Int64("rows", rows),
+		slog.Float64("elapsed_ms", float64(elapsed.Microseconds())/1000),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	logger.LogAttrs(ctx, level, message, attrs...)
+}
+
+/**
+ * Function to keep the values of a statement out of the logs, they can be password hashes and tokens
+ */
+func (l *gormLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
@@ -0,0 +1,119 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"ionixx/api/config"
+)
+
+// Value logged in place of a password, token or secret
+const redacted = "[REDACTED]"
+
+// Discard drops every log line, for tests and tools that don't log
+var Discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// contextKey is the key of the request logger in a context
+type contextKey struct{}
+
+/**
+ * Function to create the logger of the config writing to w, attributes named like a password, token or secret are redacted
+ */
+func New(cfg config.LogConfig, w io.Writer) *slog.Logger {
+	var level slog.Level
+	// The config is validated, an unknown level can't get here
+	level.UnmarshalText([]byte(cfg.Level))
+	options := &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if attr.Value.Kind() != slog.KindGroup && IsSensitive(attr.Key) {
+				attr.Value = slog.StringValue(redacted)
+			}
+			return attr
+		},
+	}
+	if cfg.Format == "text" {
+		return slog.New(slog.NewTextHandler(w, options))
+	}
+	return slog.New(slog.NewJSONHandler(w, options))
+}
+
+/**
+ * Function to get a context carrying the logger
+ */
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+/**
+ * Function to get the logger of the context, the request logger tags every line with the request id.
+ * The default logger is returned when the context has none
+ */
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+/**
+ * Function to check whether a field holds a password, token or secret by its name
+ */
+func IsSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, word := range []string{"password", "token", "secret", "authorization", "code"} {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * Function to get a loggable copy of a json or form body with the sensitive fields redacted,
+ * other bodies are not logged and give nil
+ */
+func RedactBody(contentType string, body []byte) interface{} {
+	// Clients sending json with the form content type are common, json is tried first
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err == nil {
+		return redactValue("", value)
+	}
+	if !strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		return nil
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil
+	}
+	fields := map[string]interface{}{}
+	for key, values := range form {
+		fields[key] = redactValue(key, values)
+	}
+	return fields
+}
+
+/**
+ * Function to redact the value of the key, nested objects are redacted field by field
+ */
+func redactValue(key string, value interface{}) interface{} {
+	if IsSensitive(key) {
+		return redacted
+	}
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for field, fieldValue := range value {
+			value[field] = redactValue(field, fieldValue)
+		}
+	case []interface{}:
+		// Items of an array share the name of the array
+		for i, item := range value {
+			value[i] = redactValue(key, item)
+		}
+	}
+	return value
+}
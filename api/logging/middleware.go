@@ -0,0 +1,127 @@
+package logging
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"time"
+
+	"ionixx/api/response"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the id of a request, it is accepted from the client or generated
+const RequestIDHeader = "X-Request-ID"
+
+// Request bodies longer than this are not logged
+const maxLoggedBody = 64 << 10
+
+// Request ids of the clients are accepted when they are short and can't inject anything into the logs
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+/**
+ * Function to get the middleware assigning the request id and logging every request once it is served.
+ * The request logger tagging every line with the request id is put in the request context,
+ * request bodies are logged at debug level with their passwords and tokens redacted
+ */
+func Middleware(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		c.Set("requestId", requestID)
+		c.Header(RequestIDHeader, requestID)
+
+		ctx := c.Request.Context()
+		requestLogger := logger.With(slog.String("request_id", requestID))
+		// Lines of a traced request can be found from the trace and the other way around
+		if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+			requestLogger = requestLogger.With(slog.String("trace_id", spanContext.TraceID().String()))
+		}
+		c.Request = c.Request.WithContext(NewContext(ctx, requestLogger))
+
+		var body []byte
+		if c.Request.Body != nil && requestLogger.Enabled(ctx, slog.LevelDebug) {
+			body, _ = io.ReadAll(io.LimitReader(c.Request.Body, maxLoggedBody+1))
+			// The handlers read the whole body, the part read here included
+			c.Request.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), c.Request.Body), c.Request.Body}
+		}
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		// The query string is left out, it may carry a token
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", route),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", c.ClientIP()),
+			slog.Int("response_bytes", c.Writer.Size()),
+		}
+		if userID, ok := c.Get("userId"); ok {
+			attrs = append(attrs, slog.Any("user_id", userID))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+		if len(body) > 0 && len(body) <= maxLoggedBody {
+			if redactedBody := RedactBody(c.ContentType(), body); redactedBody != nil {
+				attrs = append(attrs, slog.Any("body", redactedBody))
+			}
+		}
+		requestLogger.LogAttrs(ctx, level, "request", attrs...)
+	}
+}
+
+/**
+ * Function to get the middleware recovering from panics, the panic is logged with its stack
+ * and the client gets an internal server error
+ */
+func Recovery() gin.HandlerFunc {
+	// Gin only writes the panic to out, the logger writes it instead
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered interface{}) {
+		FromContext(c.Request.Context()).Error("panic",
+			slog.Any("error", recovered),
+			slog.String("stack", string(debug.Stack())),
+		)
+		response.ErrorJSON(c, http.StatusInternalServerError, response.CodeInternalError, "Internal server error")
+	})
+}
+
+/**
+ * Function to generate a random request id
+ */
+func newRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		// The time is unique enough when there is no randomness left
+		return time.Now().UTC().Format("20060102T150405.000000000")
+	}
+	return hex.EncodeToString(id)
+}
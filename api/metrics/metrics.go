@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prefix of every metric of the server
+const namespace = "ionixx"
+
+const (
+	LoginSuccess       = "success"
+	LoginMFARequired   = "mfa_required"
+	LoginInvalid       = "invalid_request"
+	LoginUnknownUser   = "unknown_user"
+	LoginWrongPassword = "wrong_password"
+	LoginLocked        = "locked"
+	LoginThrottled     = "throttled"
+	LoginError         = "error"
+)
+
+// Registry holds the metrics served at /metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of http requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of the http requests by method and route template.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	loginAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_login_attempts_total",
+		Help:      "Number of login attempts by outcome.",
+	}, []string{"outcome"})
+
+	bcryptDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "auth_bcrypt_duration_seconds",
+		Help:      "Time spent hashing and comparing passwords with bcrypt.",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5},
+	}, []string{"operation"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpRequestDuration,
+		loginAttempts,
+		bcryptDuration,
+	)
+}
+
+/**
+ * Function to get the middleware counting the requests and their latency by route template,
+ * requests matching no route share one label so unknown paths can't grow the series
+ */
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpRequestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+/**
+ * Function to get the handler serving the metrics in the prometheus text format
+ */
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+}
+
+/**
+ * Function to count a login attempt with one of the Login outcomes
+ */
+func ObserveLogin(outcome string) {
+	loginAttempts.WithLabelValues(outcome).Inc()
+}
+
+/**
+ * Function to record the time a bcrypt operation started at took, hash or compare
+ */
+func ObserveBcrypt(operation string, start time.Time) {
+	bcryptDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+/**
+ * Function to export the connection pool statistics of the database, the pool replaces the one
+ * registered before with the same name so a server can be set up again in the same process
+ */
+func RegisterDBStats(db *sql.DB, dbName string) error {
+	collector := collectors.NewDBStatsCollector(db, dbName)
+	err := Registry.Register(collector)
+	var registered prometheus.AlreadyRegisteredError
+	if errors.As(err, &registered) {
+		Registry.Unregister(registered.ExistingCollector)
+		return Registry.Register(collector)
+	}
+	return err
+}
@@ -1,54 +1,76 @@
 package middlewares
 
 import (
+	"ionixx/api/logging"
 	"ionixx/api/models"
 	"ionixx/api/response"
+	"ionixx/api/signing"
 	"ionixx/api/storage"
+	"log/slog"
 	"net/http"
-	"os"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
 )
 
 /**
- * Middleware to check if the user has a valid token to access the route
+ * Middleware to check if the user has a valid token to access the route, the token is verified with the keys
  */
-func AuthMiddleware(c *gin.Context) {
+func AuthMiddleware(store *storage.Store, keys *signing.KeySet) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authenticate(store.WithContext(c.Request.Context()), keys, c)
+	}
+}
+
+/**
+ * Function to authenticate the request with the sessions and revoked tokens of the store
+ */
+func authenticate(store *storage.Store, keys *signing.KeySet, c *gin.Context) {
 	// Get the token from the header
 	idTokenHeader := strings.Split(c.GetHeader("Authorization"), "Bearer ")
 
 	// If the token is not found, return an error
 	if len(idTokenHeader) < 2 {
-		response.ErrorJSON(c, http.StatusUnauthorized, "Must provide Authorization header with format `Bearer {token}`")
+		response.ErrorJSON(c, http.StatusUnauthorized, response.CodeUnauthorized, "Must provide Authorization header with format `Bearer {token}`")
 		return
 	}
 	// If the token is found, get the token
 	tokenString := idTokenHeader[1]
 
-	// Parse the token
-	token, _ := jwt.ParseWithClaims(tokenString, &models.JwtCustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("JWT_SECRET")), nil
-	})
+	// Parse the token and verify it with the key named by its kid header
+	claims := &models.JwtCustomClaims{}
+	_, err := keys.Parse(tokenString, claims)
 
-	// Check if the token is valid
-	if claims, ok := token.Claims.(*models.JwtCustomClaims); ok && token.Valid {
-		// Check if the user is in the database with user id and provided token
-		var user models.User
-		storage.DB.Model(&models.User{}).Where("auth_token = ? and id = ?", tokenString, claims.UserID).First(&user)
-		if user.ID == 0 {
-			response.ErrorJSON(c, http.StatusUnauthorized, "Unauthorized: Invalid token")
+	// Check if the token is a valid access token
+	if err == nil && claims.TokenUse == models.TokenUseAccess {
+		// Check if the session of the token is still active for the user
+		session, err := store.Sessions.FindByID(claims.SessionID)
+		if err != nil || session.UserID != claims.UserID || session.RevokedAt != nil {
+			response.ErrorJSON(c, http.StatusUnauthorized, response.CodeInvalidToken, "Invalid token")
 			return
 		}
-		// Set user id so that can be accessed from route
-		c.Set("userId", user.ID)
-
-		//Proceed to route or next middleware
-		c.Next()
+		// Check if the token itself has been revoked
+		if revoked, err := store.Tokens.IsAccessTokenRevoked(claims.Id); err != nil || revoked {
+			response.ErrorJSON(c, http.StatusUnauthorized, response.CodeTokenRevoked, "Token revoked")
+			return
+		}
+		// Record the session activity, at most once a minute to keep writes low
+		if time.Since(session.LastSeenAt) > time.Minute {
+			session.LastSeenAt = time.Now()
+			// A missed activity record doesn't stop the request, the next one retries it
+			if err := store.Sessions.Update(session, "last_seen_at"); err != nil {
+				logging.FromContext(c.Request.Context()).Error("Error recording the session activity", slog.String("error", err.Error()))
+			}
+		}
+		// Set user id, session id and role so that can be accessed from route
+		c.Set("userId", session.UserID)
+		c.Set("sessionId", session.ID)
+		c.Set("role", claims.Role)
+		//Proceed to route or next middleware, gin runs it once this middleware returns
 	} else {
 		//Return error
-		response.ErrorJSON(c, http.StatusUnauthorized, "Unauthorized: Invalid token")
+		response.ErrorJSON(c, http.StatusUnauthorized, response.CodeInvalidToken, "Invalid token")
 		return
 	}
 }
@@ -0,0 +1,59 @@
+package middlewares
+
+import (
+	"ionixx/api/models"
+	"ionixx/api/response"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+/**
+ * Middleware to check if the logged in user has one of the given roles, must run after AuthMiddleware
+ */
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Check the role set by the auth middleware against the allowed roles
+		role := c.GetString("role")
+		for _, allowed := range roles {
+			if role == allowed {
+				//Proceed to route or next middleware
+				return
+			}
+		}
+		//Return error
+		response.ErrorJSON(c, http.StatusForbidden, response.CodeForbidden, "Insufficient role")
+	}
+}
+
+/**
+ * Middleware to allow members to access only their own :id while admins can access every user, must run after AuthMiddleware
+ */
+func SelfOrAdmin(c *gin.Context) {
+	// Admins can manage every user, members can only manage themselves
+	if c.GetString("role") != models.RoleAdmin && !isSelf(c) {
+		response.ErrorJSON(c, http.StatusForbidden, response.CodeForbidden, "You can only modify your own user")
+		return
+	}
+	//Proceed to route or next middleware, gin runs it once this middleware returns
+}
+
+/**
+ * Middleware to allow users to access only their own :id regardless of role, must run after AuthMiddleware
+ */
+func Self(c *gin.Context) {
+	if !isSelf(c) {
+		response.ErrorJSON(c, http.StatusForbidden, response.CodeForbidden, "You can only modify your own user")
+		return
+	}
+	//Proceed to route or next middleware, gin runs it once this middleware returns
+}
+
+/**
+ * Function to check if the :id param is the logged in user
+ */
+func isSelf(c *gin.Context) bool {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	return err == nil && uint(id) == c.GetUint("userId")
+}
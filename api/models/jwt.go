@@ -2,8 +2,18 @@ package models
 
 import "github.com/golang-jwt/jwt"
 
+const (
+	// Token used to access the api
+	TokenUseAccess = "access"
+	// Short lived token only used to complete the mfa challenge
+	TokenUseMFA = "mfa"
+)
+
 type JwtCustomClaims struct {
-	UserID   uint   `json:"id"`
-	UserName string `json:"user_name"`
+	UserID    uint   `json:"id"`
+	UserName  string `json:"user_name"`
+	SessionID uint   `json:"sid"`
+	Role      string `json:"role"`
+	TokenUse  string `json:"token_use"`
 	jwt.StandardClaims
 }
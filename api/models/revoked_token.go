@@ -0,0 +1,13 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type RevokedToken struct {
+	gorm.Model
+	JTI       string    `json:"jti" gorm:"uniqueIndex"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
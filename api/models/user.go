@@ -6,12 +6,81 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
 type User struct {
 	gorm.Model
-	UserName    string     `json:"user_name" gorm:"uniqueIndex"`
-	AuthToken   string     `json:"auth_token"`
-	Password    string     `json:"-"`
+	UserName string `json:"user_name" gorm:"uniqueIndex"`
+	Password string `json:"-"`
+	FullName string `json:"full_name"`
+	// Email is unique among the users that are not deleted, the partial index is created by a migration
+	Email       string     `json:"email" gorm:"index"`
+	Dob         *time.Time `json:"dob"`
+	LinkedinURL string     `json:"linkedin_url"`
+	Role        string     `json:"role" gorm:"default:member"`
+	TOTPSecret  string     `json:"-"`
+	MFAEnabled  bool       `json:"mfa_enabled"`
+	// TOTPLastStep is the time step of the last accepted totp code, a code is only accepted once
+	TOTPLastStep int64 `json:"-" gorm:"not null;default:0"`
+
+	FailedLoginAttempts int        `json:"failed_login_attempts"`
+	LockedUntil         *time.Time `json:"locked_until"`
+
+	// Version is incremented by the writes of the profile and the role, the ETag of the user is made from it.
+	// The password, mfa and lockout state don't change it
+	Version uint `json:"-" gorm:"not null;default:1"`
+}
+
+// PublicUser is the profile of a user shown to other users, without the email, role, mfa and lockout state.
+// The id and timestamps keep the names of the user
+type PublicUser struct {
+	ID          uint
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	UserName    string     `json:"user_name"`
 	FullName    string     `json:"full_name"`
 	Dob         *time.Time `json:"dob"`
 	LinkedinURL string     `json:"linkedin_url"`
 }
+
+// Public returns the profile of the user shown to other users
+func (u User) Public() PublicUser {
+	return PublicUser{
+		ID:          u.ID,
+		CreatedAt:   u.CreatedAt,
+		UpdatedAt:   u.UpdatedAt,
+		UserName:    u.UserName,
+		FullName:    u.FullName,
+		Dob:         u.Dob,
+		LinkedinURL: u.LinkedinURL,
+	}
+}
+
+// UserSearchResult is a user matching a search with its rank and highlighted fields
+type UserSearchResult struct {
+	User
+	Rank      float64       `json:"rank"`
+	Highlight UserHighlight `json:"highlight" gorm:"embedded;embeddedPrefix:highlight_"`
+}
+
+// PublicUserSearchResult is a search result shown to other users
+type PublicUserSearchResult struct {
+	PublicUser
+	Rank      float64       `json:"rank"`
+	Highlight UserHighlight `json:"highlight"`
+}
+
+// Public returns the search result shown to other users
+func (r UserSearchResult) Public() PublicUserSearchResult {
+	return PublicUserSearchResult{PublicUser: r.User.Public(), Rank: r.Rank, Highlight: r.Highlight}
+}
+
+// UserHighlight holds the html escaped searched fields with the matches wrapped in <mark> tags
+type UserHighlight struct {
+	FullName    string `json:"full_name"`
+	UserName    string `json:"user_name"`
+	LinkedinURL string `json:"linkedin_url"`
+}
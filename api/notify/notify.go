@@ -0,0 +1,41 @@
+package notify
+
+import (
+	"fmt"
+	"ionixx/api/config"
+)
+
+// Message is a notification sent to a single recipient
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Notifier delivers messages to users
+type Notifier interface {
+	Send(message Message) error
+}
+
+/**
+ * Function to initialize the configured notifier
+ */
+func InitNotifier(cfg config.NotifierConfig) Notifier {
+	switch cfg.Type {
+	case "smtp":
+		return &SMTPNotifier{
+			Host:     cfg.SMTP.Host,
+			Port:     cfg.SMTP.Port,
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password,
+			From:     cfg.SMTP.From,
+		}
+	case "memory":
+		return &MemoryNotifier{}
+	case "file":
+		return &FileNotifier{Path: cfg.File}
+	default:
+		// If the notifier is unknown, panic and exit
+		panic(fmt.Sprintf("Unknown notifier %q", cfg.Type))
+	}
+}
@@ -0,0 +1,54 @@
+package notify
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// MemoryNotifier keeps sent messages in memory, used by tests
+type MemoryNotifier struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+/**
+ * Function to store the message in memory
+ */
+func (m *MemoryNotifier) Send(message Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+/**
+ * Function to get a copy of every sent message
+ */
+func (m *MemoryNotifier) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+// FileNotifier appends messages as json lines to a file, used for local development
+type FileNotifier struct {
+	Path string
+	mu   sync.Mutex
+}
+
+/**
+ * Function to append the message to the file
+ */
+func (f *FileNotifier) Send(message Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return json.NewEncoder(file).Encode(message)
+}
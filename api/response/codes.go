@@ -0,0 +1,46 @@
+package response
+
+// Codes of the problems, clients branch on them so they never change once released
+const (
+	// Requests
+	CodeInvalidRequest   = "invalid_request"
+	CodeValidationFailed = "validation_failed"
+	CodeInvalidSort      = "invalid_sort"
+	CodeInvalidCursor    = "invalid_cursor"
+	CodeNotFound         = "not_found"
+	CodeInternalError    = "internal_error"
+
+	// Writes
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodePatchConflict        = "patch_conflict"
+	CodePreconditionFailed   = "precondition_failed"
+	CodeVersionConflict      = "version_conflict"
+
+	// Authentication
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeInvalidCredentials   = "invalid_credentials"
+	CodeTooManyAttempts      = "too_many_attempts"
+	CodeInvalidToken         = "invalid_token"
+	CodeTokenRevoked         = "token_revoked"
+	CodeTokenExpired         = "token_expired"
+	CodeTokenReuseDetected   = "token_reuse_detected"
+	CodeUnsupportedTokenType = "unsupported_token_type"
+	CodeSessionRevoked       = "session_revoked"
+	CodeSessionNotFound      = "session_not_found"
+
+	// Passwords
+	CodeInvalidResetToken    = "invalid_reset_token"
+	CodeWrongCurrentPassword = "wrong_current_password"
+
+	// Mfa
+	CodeMFANotEnrolled    = "mfa_not_enrolled"
+	CodeMFAAlreadyEnabled = "mfa_already_enabled"
+	CodeMFANotEnabled     = "mfa_not_enabled"
+	CodeInvalidMFACode    = "invalid_mfa_code"
+
+	// Users
+	CodeUserNotFound  = "user_not_found"
+	CodeUserNameTaken = "user_name_taken"
+	CodeEmailTaken    = "email_taken"
+)
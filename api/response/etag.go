@@ -0,0 +1,76 @@
+package response
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// VersionETag : the strong ETag of a versioned record, it changes with every update of the record
+func VersionETag(id uint, version uint) string {
+	return fmt.Sprintf(`"%d-%d"`, id, version)
+}
+
+// HashETag : the strong ETag of a response made of several records, the hash of its json
+func HashETag(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// NotModified : sets the ETag of a read and responds not modified when the client has it already,
+// true is returned when the response is sent
+func NotModified(c *gin.Context, etag string) bool {
+	c.Header("ETag", etag)
+	// If-None-Match compares weakly, a weak ETag of the client matches the strong one
+	if !etagListMatches(c.GetHeader("If-None-Match"), etag, false) {
+		return false
+	}
+	c.AbortWithStatus(http.StatusNotModified)
+	return true
+}
+
+// IfMatch : checks the If-Match precondition of a write against the current ETag of the record,
+// writes without If-Match always pass and a failed precondition is answered with false returned
+func IfMatch(c *gin.Context, etag string) bool {
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" || etagListMatches(ifMatch, etag, true) {
+		return true
+	}
+	PreconditionFailedJSON(c)
+	return false
+}
+
+// PreconditionFailedJSON : problem json response function of a record changed since the client read it
+func PreconditionFailedJSON(c *gin.Context) {
+	ErrorJSON(c, http.StatusPreconditionFailed, CodePreconditionFailed, "The resource was changed since it was read, get it again")
+}
+
+// etagListMatches : checks whether the ETag is in the comma separated list of a header, * matches every ETag.
+// The strong comparison of If-Match never matches weak ETags
+func etagListMatches(header string, etag string, strong bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if strong {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -1,28 +1,112 @@
 package response
 
-import "github.com/gin-gonic/gin"
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// ProblemContentType is the media type of the error responses, RFC 7807
+const ProblemContentType = "application/problem+json"
 
 // Response struct
 type Response struct {
 	Success bool        `json:"success"`
 	Message string      `json:"message"`
 	Data    interface{} `json:"data"`
+	Meta    interface{} `json:"meta,omitempty"`
+	// RequestID is the X-Request-ID of the request, to find its log lines
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Problem : RFC 7807 problem details of an error response, clients branch on the code
+type Problem struct {
+	// Type is about:blank, the code tells the errors apart
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Code is one of the Code constants, it never changes once released
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError : a field of the request failing validation
+type FieldError struct {
+	// Field is the name of the field in the json body or the query
+	Field string `json:"field"`
+	// Constraint is the rule that failed and Param its parameter, like min and 6
+	Constraint string `json:"constraint"`
+	Param      string `json:"param,omitempty"`
+	Message    string `json:"message"`
+}
+
+// PageMeta : pagination metadata of a list response
+type PageMeta struct {
+	Total      int64  `json:"total"`
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// ErrorJSON : problem json error response function, the code is one of the Code constants
+func ErrorJSON(c *gin.Context, statusCode int, code string, detail string) {
+	problemJSON(c, &Problem{Status: statusCode, Code: code, Detail: detail})
 }
 
-// ErrorJSON : json error response function
-func ErrorJSON(c *gin.Context, statusCode int, err string) {
-	c.AbortWithStatusJSON(statusCode, &Response{
-		Success: false,
-		Message: err,
-		Data:    nil,
+// ValidationErrorJSON : problem json response function of the fields failing validation
+func ValidationErrorJSON(c *gin.Context, fieldErrors []FieldError) {
+	problemJSON(c, &Problem{
+		Status: http.StatusUnprocessableEntity,
+		Code:   CodeValidationFailed,
+		Detail: "The request has invalid fields",
+		Errors: fieldErrors,
 	})
 }
 
+// BindErrorJSON : problem json response function of a binding error, every field failing validation is listed
+// in a 422 and requests that can't be parsed are 400
+func BindErrorJSON(c *gin.Context, err error) {
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		ValidationErrorJSON(c, fieldErrors(validationErrors))
+		return
+	}
+	ErrorJSON(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+}
+
+// problemJSON : renders the problem as application/problem+json and stops the handlers after this one
+func problemJSON(c *gin.Context, problem *Problem) {
+	problem.Type = "about:blank"
+	problem.Title = http.StatusText(problem.Status)
+	problem.Instance = c.Request.URL.Path
+	problem.RequestID = c.GetString("requestId")
+	// The json render keeps a content type set before it
+	c.Header("Content-Type", ProblemContentType)
+	c.AbortWithStatusJSON(problem.Status, problem)
+}
+
 // SuccessJSON : json error response function
 func SuccessJSON(c *gin.Context, statusCode int, message string, data interface{}) {
 	c.JSON(statusCode, &Response{
-		Success: true,
-		Message: message,
-		Data:    data,
+		Success:   true,
+		Message:   message,
+		Data:      data,
+		RequestID: c.GetString("requestId"),
+	})
+}
+
+// SuccessJSONWithMeta : json success response function with metadata
+func SuccessJSONWithMeta(c *gin.Context, statusCode int, message string, data interface{}, meta interface{}) {
+	c.JSON(statusCode, &Response{
+		Success:   true,
+		Message:   message,
+		Data:      data,
+		Meta:      meta,
+		RequestID: c.GetString("requestId"),
 	})
 }
@@ -0,0 +1,71 @@
+package response
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/locales/en"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	entranslations "github.com/go-playground/validator/v10/translations/en"
+)
+
+// translator renders the messages of the fields failing validation
+var translator ut.Translator
+
+// init : set up the validator of gin before any request is bound, the validator caches the names of the fields with the first struct it checks
+func init() {
+	translator, _ = ut.New(en.New()).GetTranslator("en")
+	validate, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	validate.RegisterTagNameFunc(fieldName)
+	if err := entranslations.RegisterDefaultTranslations(validate, translator); err != nil {
+		panic(err)
+	}
+	// Rules used by the requests that have no default message
+	validate.RegisterTranslation("required_without", translator,
+		func(t ut.Translator) error {
+			return t.Add("required_without", "{0} is required when {1} is not given", true)
+		},
+		func(t ut.Translator, fe validator.FieldError) string {
+			message, _ := t.T("required_without", fe.Field(), fe.Param())
+			return message
+		},
+	)
+}
+
+// fieldName : get the name of a field as the client sends it, the json name or the form name of a query
+func fieldName(field reflect.StructField) string {
+	for _, tag := range []string{"json", "form"} {
+		name := strings.SplitN(field.Tag.Get(tag), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// fieldErrors : get the errors of every field failing validation with a readable message
+func fieldErrors(validationErrors validator.ValidationErrors) []FieldError {
+	fieldErrors := make([]FieldError, 0, len(validationErrors))
+	for _, fieldErr := range validationErrors {
+		message := fieldErr.Translate(translator)
+		// Rules without a message give the error of the validator, which names the go field
+		if message == fieldErr.Error() {
+			message = fieldErr.Field() + " failed on the " + fieldErr.Tag() + " rule"
+		}
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:      fieldErr.Field(),
+			Constraint: fieldErr.Tag(),
+			Param:      fieldErr.Param(),
+			Message:    message,
+		})
+	}
+	return fieldErrors
+}
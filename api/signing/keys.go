@@ -0,0 +1,263 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"ionixx/api/config"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Key is a single jwt signing key identified by its kid
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	// PrivateKey is nil for retiring keys that are only kept to verify tokens
+	PrivateKey crypto.PrivateKey
+	PublicKey  crypto.PublicKey
+}
+
+// KeySet holds the active signing key and the retiring keys still accepted for verification
+type KeySet struct {
+	active *Key
+	keys   map[string]*Key
+	ids    []string
+}
+
+/**
+ * Function to initialize the signing keys the tokens of a server are signed and verified with
+ */
+func InitKeys(cfg config.JWTConfig, logger *slog.Logger) *KeySet {
+	var keys *KeySet
+	var err error
+	// Load the keys from the key directory, or generate an ephemeral key when development allows it
+	switch {
+	case cfg.KeysDir != "":
+		keys, err = LoadKeySet(cfg.KeysDir, cfg.ActiveKID)
+	case cfg.EphemeralKeys:
+		keys, err = GenerateKeySet()
+		logger.Warn("Generated an ephemeral signing key, tokens are invalidated by a restart and rejected by other replicas, set JWT_KEYS_DIR in production")
+	default:
+		err = errors.New("JWT_KEYS_DIR is required unless JWT_EPHEMERAL_KEYS is set")
+	}
+	// If there is an error loading the keys, panic and exit
+	if err != nil {
+		panic(err)
+	}
+	logger.Info("Signing keys loaded", slog.String("active_kid", keys.active.ID))
+	return keys
+}
+
+/**
+ * Function to create a key set, the active key must have a private key
+ */
+func NewKeySet(activeID string, keys ...*Key) (*KeySet, error) {
+	set := &KeySet{keys: map[string]*Key{}}
+	for _, key := range keys {
+		if _, ok := set.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate signing key %q", key.ID)
+		}
+		set.keys[key.ID] = key
+		set.ids = append(set.ids, key.ID)
+	}
+	sort.Strings(set.ids)
+
+	set.active = set.keys[activeID]
+	if set.active == nil {
+		return nil, fmt.Errorf("active signing key %q not found", activeID)
+	}
+	if set.active.PrivateKey == nil {
+		return nil, fmt.Errorf("active signing key %q has no private key", activeID)
+	}
+	return set, nil
+}
+
+/**
+ * Function to generate a key set with a single ephemeral Ed25519 key
+ */
+func GenerateKeySet() (*KeySet, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	key, err := NewKey("ephemeral", privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeySet(key.ID, key)
+}
+
+/**
+ * Function to load every <kid>.pem file of the directory into a key set.
+ * Files holding only a public key are kept as retiring keys for verification.
+ * When activeID is empty the directory must hold exactly one private key.
+ */
+func LoadKeySet(dir string, activeID string) (*KeySet, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []*Key
+	var privateIDs []string
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := parsePEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		key, err := NewKey(strings.TrimSuffix(filepath.Base(file), ".pem"), parsed)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if key.PrivateKey != nil {
+			privateIDs = append(privateIDs, key.ID)
+		}
+		keys = append(keys, key)
+	}
+
+	if activeID == "" {
+		if len(privateIDs) != 1 {
+			return nil, fmt.Errorf("JWT_ACTIVE_KID must be set when %s holds %d private keys", dir, len(privateIDs))
+		}
+		activeID = privateIDs[0]
+	}
+	return NewKeySet(activeID, keys...)
+}
+
+/**
+ * Function to create a key from a private or public RSA, ECDSA or Ed25519 key
+ */
+func NewKey(id string, key interface{}) (*Key, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return &Key{ID: id, Method: jwt.SigningMethodRS256, PrivateKey: k, PublicKey: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &Key{ID: id, Method: jwt.SigningMethodRS256, PublicKey: k}, nil
+	case *ecdsa.PrivateKey:
+		method, err := ecdsaMethod(k.Curve)
+		if err != nil {
+			return nil, err
+		}
+		return &Key{ID: id, Method: method, PrivateKey: k, PublicKey: &k.PublicKey}, nil
+	case *ecdsa.PublicKey:
+		method, err := ecdsaMethod(k.Curve)
+		if err != nil {
+			return nil, err
+		}
+		return &Key{ID: id, Method: method, PublicKey: k}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: id, Method: jwt.SigningMethodEdDSA, PrivateKey: k, PublicKey: k.Public()}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: id, Method: jwt.SigningMethodEdDSA, PublicKey: k}, nil
+	}
+	return nil, fmt.Errorf("unsupported signing key type %T", key)
+}
+
+/**
+ * Function to pick the ECDSA signing method matching the curve
+ */
+func ecdsaMethod(curve elliptic.Curve) (jwt.SigningMethod, error) {
+	switch curve {
+	case elliptic.P256():
+		return jwt.SigningMethodES256, nil
+	case elliptic.P384():
+		return jwt.SigningMethodES384, nil
+	case elliptic.P521():
+		return jwt.SigningMethodES512, nil
+	}
+	return nil, fmt.Errorf("unsupported ecdsa curve %s", curve.Params().Name)
+}
+
+/**
+ * Function to parse the first PEM block into a private or public key
+ */
+func parsePEM(data []byte) (interface{}, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+}
+
+/**
+ * Function to get the active signing key
+ */
+func (s *KeySet) Active() *Key {
+	return s.active
+}
+
+/**
+ * Function to sign the claims with the active key, the kid header names the key
+ */
+func (s *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(s.active.Method, claims)
+	token.Header["kid"] = s.active.ID
+	return token.SignedString(s.active.PrivateKey)
+}
+
+/**
+ * Function to check the active key signs a token the key set verifies again
+ */
+func (s *KeySet) Check() error {
+	token, err := s.Sign(jwt.StandardClaims{Subject: "check", ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	if err != nil {
+		return err
+	}
+	_, err = s.Parse(token, &jwt.StandardClaims{})
+	return err
+}
+
+/**
+ * Function to parse and verify a token with the key named by its kid header
+ */
+func (s *KeySet) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := s.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		// Only accept the algorithm of the key to prevent algorithm confusion
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		return key.PublicKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return token, nil
+}
@@ -2,42 +2,99 @@ package storage
 
 import (
 	"fmt"
+	"ionixx/api/config"
+	"ionixx/api/logging"
 	"ionixx/api/models"
-	"os"
+	"ionixx/api/tracing"
+	"log/slog"
 
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-var DB *gorm.DB
+/**
+ * Function to open the database of the driver, postgres or sqlite, gorm logs to the logger
+ */
+func OpenDB(driver string, dsn string, logger *slog.Logger) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	switch driver {
+	case "", "postgres":
+		dialector = postgres.Open(dsn)
+	case "sqlite":
+		dialector = sqlite.Open(dsn)
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", driver)
+	}
+
+	// Dialects that support it translate their unique violations into gorm.ErrDuplicatedKey
+	db, err := gorm.Open(dialector, &gorm.Config{TranslateError: true, Logger: logging.GormLogger(logger)})
+	if err != nil {
+		return nil, err
+	}
+	// Every statement gets a span, a child of the request span when the repository has the request context
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		return nil, err
+	}
+	// Sqlite allows a single writer, and every connection to an in-memory database opens a new empty one
+	if driver == "sqlite" {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		sqlDB.SetMaxOpenConns(1)
+	}
+	return db, nil
+}
+
+/**
+ * Function to initialize the store of the configured driver
+ */
+func InitStore(cfg config.DatabaseConfig, logger *slog.Logger) *Store {
+	// The memory store keeps nothing between restarts, it needs no database
+	if cfg.Driver == "memory" {
+		logger.Warn("Using the in-memory store, nothing is kept between restarts")
+		return NewMemoryStore()
+	}
+	return NewGormStore(InitDB(cfg, logger))
+}
 
 /**
  * Function to initialize the database
  */
-func InitDB() {
-	var err error
+func InitDB(cfg config.DatabaseConfig, logger *slog.Logger) *gorm.DB {
 	// Open database connection using the DSN
-	DB, err = gorm.Open(postgres.Open(os.Getenv("DSN")), &gorm.Config{})
+	db, err := OpenDB(cfg.Driver, cfg.DSN, logger)
 	// If there is an error opening the database, panic and exit
 	if err != nil {
 		panic(err)
 	}
-	fmt.Println("DB connected successfully!")
-	DB.AutoMigrate(&models.User{})
+	logger.Info("DB connected successfully", slog.String("driver", cfg.Driver))
+	// Apply the pending migrations, if there is an error migrating, panic and exit
+	applied, err := MigrateUp(db)
+	if err != nil {
+		panic(err)
+	}
+	for _, migration := range applied {
+		logger.Info("Applied migration", slog.Uint64("version", uint64(migration.Version)), slog.String("name", migration.Name))
+	}
+	return db
 }
 
 /**
- * Function to initialize the test database
+ * Function to initialize an empty test database, the tables of the previous run are dropped
  */
-func InitTestDB() {
-	var err error
-	// Open database connection using the DSN
-	DB, err = gorm.Open(postgres.Open(os.Getenv("DSN")), &gorm.Config{})
-	// If there is an error opening the database, panic and exit
+func InitTestDB(driver string, dsn string) (*gorm.DB, error) {
+	db, err := OpenDB(driver, dsn, logging.Discard)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	tables := []interface{}{&SchemaMigration{}, &models.User{}, &models.Session{}, &models.RefreshToken{}, &models.RevokedToken{}, &models.PasswordResetToken{}, &models.RecoveryCode{}}
+	if err := db.Migrator().DropTable(tables...); err != nil {
+		return nil, err
+	}
+	if _, err := MigrateUp(db); err != nil {
+		return nil, err
 	}
-	fmt.Println("DB connected successfully!")
-	DB.Migrator().DropTable(&models.User{})
-	DB.AutoMigrate(&models.User{})
+	return db, nil
 }
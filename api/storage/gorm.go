@@ -0,0 +1,522 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ionixx/api/limiter"
+	"ionixx/api/models"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+/**
+ * Function to create a store backed by the gorm database
+ */
+func NewGormStore(db *gorm.DB) *Store {
+	return &Store{
+		Users:          &gormUserRepository{db: db},
+		Sessions:       &gormSessionRepository{db: db},
+		Tokens:         &gormTokenRepository{db: db},
+		PasswordResets: &gormPasswordResetRepository{db: db},
+		RecoveryCodes:  &gormRecoveryCodeRepository{db: db},
+		Health:         &gormHealthChecker{db: db},
+		db:             db,
+	}
+}
+
+/**
+ * Function to convert the gorm and postgres errors to the storage errors
+ */
+func translateError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrDuplicate
+	}
+	// 23505 is the postgres unique violation
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrDuplicate
+	}
+	return err
+}
+
+/**
+ * Function to save the given columns of the model, or every column when none is given
+ */
+func updateColumns(db *gorm.DB, model interface{}, columns []string) error {
+	if len(columns) == 0 {
+		return translateError(db.Save(model).Error)
+	}
+	return translateError(db.Model(model).Select(columns).Updates(model).Error)
+}
+
+type gormUserRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormUserRepository) Create(user *models.User) error {
+	return r.duplicateEmail(user, translateError(r.db.Create(user).Error))
+}
+
+/**
+ * Function to tell whether a duplicate of the user is their email, another user having it, or the user name
+ */
+func (r *gormUserRepository) duplicateEmail(user *models.User, err error) error {
+	if !errors.Is(err, ErrDuplicate) || user.Email == "" {
+		return err
+	}
+	var count int64
+	if err := r.db.Model(&models.User{}).Where("email = ? and id <> ?", user.Email, user.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrEmailTaken
+	}
+	return err
+}
+
+func (r *gormUserRepository) FindByID(id uint) (*models.User, error) {
+	var user models.User
+	if err := r.db.First(&user, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) FindByUserName(userName string) (*models.User, error) {
+	var user models.User
+	if err := r.db.Where("user_name = ?", userName).First(&user).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) FindByEmail(email string) (*models.User, error) {
+	var user models.User
+	if err := r.db.Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) List(query UserQuery) ([]models.User, int64, error) {
+	// Count the users matching the filters
+	filtered := filterUsers(r.db.Model(&models.User{}), query).Session(&gorm.Session{})
+	var total int64
+	if err := filtered.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// Start after the cursor, or skip the offset when there is no cursor
+	page := filtered
+	if query.After != nil {
+		page = usersAfter(page, query)
+	} else {
+		page = page.Offset(query.Offset)
+	}
+
+	var users []models.User
+	if err := orderUsers(page, query).Limit(query.Limit).Find(&users).Error; err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+/**
+ * Function to filter the users by the query
+ */
+func filterUsers(db *gorm.DB, query UserQuery) *gorm.DB {
+	if query.UserName != "" {
+		db = db.Where("lower(user_name) like ?", "%"+strings.ToLower(query.UserName)+"%")
+	}
+	if query.FullName != "" {
+		db = db.Where("lower(full_name) like ?", "%"+strings.ToLower(query.FullName)+"%")
+	}
+	if !query.DobFrom.IsZero() {
+		db = db.Where("dob >= ?", query.DobFrom)
+	}
+	if !query.DobBefore.IsZero() {
+		db = db.Where("dob < ?", query.DobBefore)
+	}
+	if !query.CreatedFrom.IsZero() {
+		db = db.Where("created_at >= ?", query.CreatedFrom)
+	}
+	if !query.CreatedTo.IsZero() {
+		db = db.Where("created_at <= ?", query.CreatedTo)
+	}
+	return db
+}
+
+/**
+ * Function to order the users by the sort field, the id breaks the ties
+ */
+func orderUsers(db *gorm.DB, query UserQuery) *gorm.DB {
+	direction := "asc"
+	if query.Desc {
+		direction = "desc"
+	}
+	if UserSortFields[query.Sort].Nullable {
+		db = db.Order(query.Sort + " is null")
+	}
+	if query.Sort != "id" {
+		db = db.Order(query.Sort + " " + direction)
+	}
+	return db.Order("id " + direction)
+}
+
+/**
+ * Function to filter the users to the ones sorted after the cursor
+ */
+func usersAfter(db *gorm.DB, query UserQuery) *gorm.DB {
+	operator := ">"
+	if query.Desc {
+		operator = "<"
+	}
+	after := query.After
+	if query.Sort == "id" {
+		return db.Where("id "+operator+" ?", after.ID)
+	}
+
+	// Null values come last, so after a null only the nulls with a later id are left
+	if after.Value == nil {
+		return db.Where(query.Sort+" is null and id "+operator+" ?", after.ID)
+	}
+	condition := fmt.Sprintf("(%[1]s %[2]s ? or (%[1]s = ? and id %[2]s ?))", query.Sort, operator)
+	if UserSortFields[query.Sort].Nullable {
+		condition = fmt.Sprintf("((%s is not null and %s) or %s is null)", query.Sort, condition, query.Sort)
+	}
+	return db.Where(condition, after.Value, after.Value, after.ID)
+}
+
+func (r *gormUserRepository) Search(search string, limit int) ([]models.UserSearchResult, error) {
+	return searchUsersGorm(r.db, search, limit)
+}
+
+func (r *gormUserRepository) Update(user *models.User, columns ...string) error {
+	return r.update(user, false, columns)
+}
+
+func (r *gormUserRepository) UpdateIfVersion(user *models.User, columns ...string) error {
+	return r.update(user, true, columns)
+}
+
+/**
+ * Function to save the columns, a versioned write checks and increments the version of the user in the same transaction
+ */
+func (r *gormUserRepository) update(user *models.User, versioned bool, columns []string) error {
+	if !versioned {
+		return r.duplicateEmail(user, r.saveColumns(user, columns))
+	}
+	// The email is checked once the transaction is rolled back, postgres refuses statements in a failed transaction
+	return r.duplicateEmail(user, r.db.Transaction(func(tx *gorm.DB) error {
+		// The incremented row stays locked until the columns are saved, so no update runs in between
+		result := tx.Model(&models.User{}).Where("id = ? and version = ?", user.ID, user.Version).
+			UpdateColumn("version", gorm.Expr("version + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return r.missingOrConflict(tx, user.ID)
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Pluck("version", &user.Version).Error; err != nil {
+			return err
+		}
+		return updateColumns(tx, user, columns)
+	}))
+}
+
+/**
+ * Function to save the columns of the user without changing the version, the version of the user is left out
+ * so a stale one isn't written back
+ */
+func (r *gormUserRepository) saveColumns(user *models.User, columns []string) error {
+	db := r.db.Model(user)
+	if len(columns) == 0 {
+		db = db.Select("*").Omit("version", "id", "created_at")
+	} else {
+		db = db.Select(columns)
+	}
+	result := db.Updates(user)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormUserRepository) Delete(id uint) error {
+	result := r.db.Delete(&models.User{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormUserRepository) DeleteIfVersion(id uint, version uint) error {
+	result := r.db.Where("version = ?", version).Delete(&models.User{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return r.missingOrConflict(r.db, id)
+	}
+	return nil
+}
+
+/**
+ * Function to tell why no user was changed, it is missing or has another version
+ */
+func (r *gormUserRepository) missingOrConflict(db *gorm.DB, id uint) error {
+	var count int64
+	if err := db.Model(&models.User{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return ErrConflict
+}
+
+func (r *gormUserRepository) IncrementFailedLogins(user *models.User, lockout Lockout) error {
+	// Increment and lock in one statement so concurrent failures are all counted and the lock follows the count
+	result := r.db.Model(&models.User{}).
+		Where("id = ?", user.ID).
+		UpdateColumns(map[string]interface{}{
+			"failed_login_attempts": gorm.Expr("failed_login_attempts + ?", 1),
+			"locked_until":          lockedUntilExpr(lockout, time.Now()),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	return translateError(r.db.First(user, user.ID).Error)
+}
+
+/**
+ * Function to get the expression of the locked_until column after one more failed login, the count is the one
+ * before the update. Every count locking for less than the maximum delay gets its own case
+ */
+func lockedUntilExpr(lockout Lockout, now time.Time) clause.Expr {
+	sql := "CASE WHEN failed_login_attempts + 1 < ? THEN locked_until"
+	vars := []interface{}{lockout.Threshold}
+	failures := lockout.Threshold
+	delay := limiter.Delay(failures, lockout.Threshold, lockout.BaseDelay, lockout.MaxDelay)
+	for ; delay > 0 && delay < lockout.MaxDelay; failures++ {
+		sql += " WHEN failed_login_attempts + 1 = ? THEN ?"
+		vars = append(vars, failures, now.Add(delay))
+		delay = limiter.Delay(failures+1, lockout.Threshold, lockout.BaseDelay, lockout.MaxDelay)
+	}
+	// The counts above lock for the delay of the last one, the maximum
+	return gorm.Expr(sql+" ELSE ? END", append(vars, now.Add(delay))...)
+}
+
+func (r *gormUserRepository) UseTOTPStep(userID uint, step int64) (bool, error) {
+	// Only one concurrent request can move the step forward
+	result := r.db.Model(&models.User{}).
+		Where("id = ? and totp_last_step < ?", userID, step).
+		UpdateColumn("totp_last_step", step)
+	return result.RowsAffected > 0, result.Error
+}
+
+type gormSessionRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormSessionRepository) Create(session *models.Session) error {
+	return r.db.Create(session).Error
+}
+
+func (r *gormSessionRepository) FindByID(id uint) (*models.Session, error) {
+	var session models.Session
+	if err := r.db.First(&session, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &session, nil
+}
+
+func (r *gormSessionRepository) ListActive(userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	result := r.db.Where("user_id = ? and revoked_at is null and expires_at > ?", userID, time.Now()).
+		Order("last_seen_at desc").
+		Find(&sessions)
+	return sessions, result.Error
+}
+
+func (r *gormSessionRepository) Update(session *models.Session, columns ...string) error {
+	return updateColumns(r.db, session, columns)
+}
+
+func (r *gormSessionRepository) Revoke(sessionID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&models.Session{}).
+			Where("id = ? and revoked_at is null", sessionID).
+			Update("revoked_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		return tx.Model(&models.RefreshToken{}).
+			Where("session_id = ? and revoked_at is null", sessionID).
+			Update("revoked_at", now).Error
+	})
+}
+
+func (r *gormSessionRepository) RevokeAll(userID uint, exceptSessionID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&models.Session{}).
+			Where("user_id = ? and id <> ? and revoked_at is null", userID, exceptSessionID).
+			Update("revoked_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		return tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? and session_id <> ? and revoked_at is null", userID, exceptSessionID).
+			Update("revoked_at", now).Error
+	})
+}
+
+type gormTokenRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormTokenRepository) CreateRefreshToken(token *models.RefreshToken) error {
+	return translateError(r.db.Create(token).Error)
+}
+
+func (r *gormTokenRepository) FindRefreshToken(tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	if err := r.db.Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &token, nil
+}
+
+func (r *gormTokenRepository) UseRefreshToken(id uint) (bool, error) {
+	result := r.db.Model(&models.RefreshToken{}).
+		Where("id = ? and revoked_at is null", id).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormTokenRepository) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	// Drop denylist entries of tokens that have expired on their own
+	result := r.db.Unscoped().Where("expires_at < ?", time.Now()).Delete(&models.RevokedToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	return r.db.Where(models.RevokedToken{JTI: jti}).
+		FirstOrCreate(&models.RevokedToken{JTI: jti, ExpiresAt: expiresAt}).Error
+}
+
+func (r *gormTokenRepository) IsAccessTokenRevoked(jti string) (bool, error) {
+	var count int64
+	result := r.db.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count)
+	return count > 0, result.Error
+}
+
+func (r *gormTokenRepository) UseMFAChallenge(jti string, expiresAt time.Time) (bool, error) {
+	// Used challenges share the denylist of the revoked access tokens, the unique jti lets one insert win
+	err := translateError(r.db.Create(&models.RevokedToken{JTI: jti, ExpiresAt: expiresAt}).Error)
+	if errors.Is(err, ErrDuplicate) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+type gormPasswordResetRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormPasswordResetRepository) Create(token *models.PasswordResetToken) error {
+	return translateError(r.db.Create(token).Error)
+}
+
+func (r *gormPasswordResetRepository) InvalidateAll(userID uint) error {
+	return r.db.Model(&models.PasswordResetToken{}).
+		Where("user_id = ? and used_at is null", userID).
+		Update("used_at", time.Now()).Error
+}
+
+func (r *gormPasswordResetRepository) Use(tokenHash string) (*models.PasswordResetToken, error) {
+	var token models.PasswordResetToken
+	result := r.db.Where("token_hash = ? and used_at is null and expires_at > ?", tokenHash, time.Now()).First(&token)
+	if result.Error != nil {
+		return nil, translateError(result.Error)
+	}
+
+	// Only one concurrent request can win this update
+	result = r.db.Model(&token).Where("used_at is null").Update("used_at", time.Now())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrNotFound
+	}
+	return &token, nil
+}
+
+type gormRecoveryCodeRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormRecoveryCodeRepository) Replace(userID uint, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]models.RecoveryCode, 0, len(codeHashes))
+		for _, codeHash := range codeHashes {
+			codes = append(codes, models.RecoveryCode{UserID: userID, CodeHash: codeHash})
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+func (r *gormRecoveryCodeRepository) Use(userID uint, codeHash string) (bool, error) {
+	result := r.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? and code_hash = ? and used_at is null", userID, codeHash).
+		Update("used_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormRecoveryCodeRepository) DeleteAll(userID uint) error {
+	return r.db.Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+}
+
+type gormHealthChecker struct {
+	db *gorm.DB
+}
+
+func (h *gormHealthChecker) Ping(ctx context.Context) error {
+	sqlDB, err := h.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+func (h *gormHealthChecker) PendingMigrations(ctx context.Context) (int, error) {
+	statuses, err := MigrationStatuses(h.db.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending++
+		}
+	}
+	return pending, nil
+}
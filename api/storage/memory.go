@@ -0,0 +1,728 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"ionixx/api/models"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// memoryDB holds the tables of the in-memory store, every repository shares its lock
+type memoryDB struct {
+	mu sync.Mutex
+
+	users         map[uint]models.User
+	sessions      map[uint]models.Session
+	refreshTokens map[uint]models.RefreshToken
+	revokedTokens map[string]time.Time
+	resetTokens   map[uint]models.PasswordResetToken
+	recoveryCodes map[uint]models.RecoveryCode
+
+	lastUserID         uint
+	lastSessionID      uint
+	lastRefreshTokenID uint
+	lastResetTokenID   uint
+	lastRecoveryCodeID uint
+}
+
+/**
+ * Function to create a store that keeps everything in memory, the data is lost on restart
+ */
+func NewMemoryStore() *Store {
+	db := &memoryDB{
+		users:         map[uint]models.User{},
+		sessions:      map[uint]models.Session{},
+		refreshTokens: map[uint]models.RefreshToken{},
+		revokedTokens: map[string]time.Time{},
+		resetTokens:   map[uint]models.PasswordResetToken{},
+		recoveryCodes: map[uint]models.RecoveryCode{},
+	}
+	return &Store{
+		Users:          &memoryUserRepository{db},
+		Sessions:       &memorySessionRepository{db},
+		Tokens:         &memoryTokenRepository{db},
+		PasswordResets: &memoryPasswordResetRepository{db},
+		RecoveryCodes:  &memoryRecoveryCodeRepository{db},
+		Health:         memoryHealthChecker{},
+	}
+}
+
+/**
+ * Function to copy the given columns of a struct to another struct of the same type.
+ * Columns are named the way gorm names them, so the repositories accept the same columns.
+ */
+func copyColumns(dst interface{}, src interface{}, columns []string) error {
+	wanted := map[string]bool{}
+	for _, column := range columns {
+		wanted[column] = true
+	}
+	copied := copyStructColumns(reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem(), wanted)
+	if copied != len(wanted) {
+		return fmt.Errorf("unknown column in %v", columns)
+	}
+	return nil
+}
+
+/**
+ * Function to copy the wanted columns field by field, embedded structs like gorm.Model included
+ */
+func copyStructColumns(dst reflect.Value, src reflect.Value, wanted map[string]bool) int {
+	naming := schema.NamingStrategy{}
+	copied := 0
+	for i := 0; i < dst.NumField(); i++ {
+		field := dst.Type().Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			copied += copyStructColumns(dst.Field(i), src.Field(i), wanted)
+			continue
+		}
+		if wanted[naming.ColumnName("", field.Name)] {
+			dst.Field(i).Set(src.Field(i))
+			copied++
+		}
+	}
+	return copied
+}
+
+type memoryUserRepository struct {
+	db *memoryDB
+}
+
+func (r *memoryUserRepository) Create(user *models.User) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	// Deleted users keep their user name taken, like the unique index of the database
+	for _, existing := range r.db.users {
+		if existing.UserName == user.UserName {
+			return ErrDuplicate
+		}
+	}
+	if r.emailTaken(user) {
+		return ErrEmailTaken
+	}
+
+	r.db.lastUserID++
+	now := time.Now()
+	user.ID = r.db.lastUserID
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	if user.Role == "" {
+		user.Role = models.RoleMember
+	}
+	user.Version = 1
+	r.db.users[user.ID] = *user
+	return nil
+}
+
+/**
+ * Function to find the user with the lowest id matching the condition, the lock must be held
+ */
+func (r *memoryUserRepository) find(match func(user models.User) bool) (*models.User, error) {
+	var found *models.User
+	for _, user := range r.db.users {
+		if user.DeletedAt.Valid || !match(user) {
+			continue
+		}
+		if found == nil || user.ID < found.ID {
+			user := user
+			found = &user
+		}
+	}
+	if found == nil {
+		return nil, ErrNotFound
+	}
+	return found, nil
+}
+
+func (r *memoryUserRepository) FindByID(id uint) (*models.User, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	return r.find(func(user models.User) bool { return user.ID == id })
+}
+
+func (r *memoryUserRepository) FindByUserName(userName string) (*models.User, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	return r.find(func(user models.User) bool { return user.UserName == userName })
+}
+
+func (r *memoryUserRepository) FindByEmail(email string) (*models.User, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	return r.find(func(user models.User) bool { return user.Email == email })
+}
+
+/**
+ * Function to list the users that are not deleted sorted by id, the lock must be held
+ */
+func (r *memoryUserRepository) all() []models.User {
+	users := make([]models.User, 0, len(r.db.users))
+	for _, user := range r.db.users {
+		if !user.DeletedAt.Valid {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users
+}
+
+func (r *memoryUserRepository) List(query UserQuery) ([]models.User, int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var users []models.User
+	for _, user := range r.all() {
+		if matchUser(user, query) {
+			users = append(users, user)
+		}
+	}
+	total := int64(len(users))
+
+	sort.SliceStable(users, func(i, j int) bool {
+		return compareUsers(query, UserSortValue(users[i], query.Sort), users[i].ID, UserSortValue(users[j], query.Sort), users[j].ID) < 0
+	})
+
+	// Start after the cursor, or skip the offset when there is no cursor
+	start := query.Offset
+	if query.After != nil {
+		start = sort.Search(len(users), func(i int) bool {
+			return compareUsers(query, UserSortValue(users[i], query.Sort), users[i].ID, query.After.Value, query.After.ID) > 0
+		})
+	}
+	if start > len(users) {
+		start = len(users)
+	}
+	users = users[start:]
+	if query.Limit > 0 && len(users) > query.Limit {
+		users = users[:query.Limit]
+	}
+	return users, total, nil
+}
+
+/**
+ * Function to check if the user matches the filters of the query
+ */
+func matchUser(user models.User, query UserQuery) bool {
+	if query.UserName != "" && !strings.Contains(strings.ToLower(user.UserName), strings.ToLower(query.UserName)) {
+		return false
+	}
+	if query.FullName != "" && !strings.Contains(strings.ToLower(user.FullName), strings.ToLower(query.FullName)) {
+		return false
+	}
+	if !query.DobFrom.IsZero() && (user.Dob == nil || user.Dob.Before(query.DobFrom)) {
+		return false
+	}
+	if !query.DobBefore.IsZero() && (user.Dob == nil || !user.Dob.Before(query.DobBefore)) {
+		return false
+	}
+	if !query.CreatedFrom.IsZero() && user.CreatedAt.Before(query.CreatedFrom) {
+		return false
+	}
+	if !query.CreatedTo.IsZero() && user.CreatedAt.After(query.CreatedTo) {
+		return false
+	}
+	return true
+}
+
+/**
+ * Function to compare the sort positions of two users the way the database orders them
+ */
+func compareUsers(query UserQuery, a interface{}, aID uint, b interface{}, bID uint) int {
+	if query.Sort != "id" {
+		// Null values come last in both directions
+		switch {
+		case a == nil && b != nil:
+			return 1
+		case a != nil && b == nil:
+			return -1
+		case a != nil && b != nil:
+			if compared := compareValues(a, b); compared != 0 {
+				if query.Desc {
+					return -compared
+				}
+				return compared
+			}
+		}
+	}
+
+	compared := 0
+	if aID < bID {
+		compared = -1
+	} else if aID > bID {
+		compared = 1
+	}
+	if query.Desc {
+		return -compared
+	}
+	return compared
+}
+
+/**
+ * Function to compare two sort values of the same type, values of different types are equal
+ */
+func compareValues(a interface{}, b interface{}) int {
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b)
+		}
+	case time.Time:
+		if b, ok := b.(time.Time); ok {
+			if a.Before(b) {
+				return -1
+			}
+			if a.After(b) {
+				return 1
+			}
+		}
+	}
+	return 0
+}
+
+func (r *memoryUserRepository) Search(search string, limit int) ([]models.UserSearchResult, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	terms := searchTerms(search)
+	if len(terms) == 0 {
+		return []models.UserSearchResult{}, nil
+	}
+
+	// Every word must be contained in one of the fields
+	var users []models.User
+	for _, user := range r.all() {
+		fields := strings.ToLower(user.FullName + "\n" + user.UserName + "\n" + user.LinkedinURL)
+		matched := true
+		for _, term := range terms {
+			if !strings.Contains(fields, term) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			users = append(users, user)
+		}
+	}
+	return rankUsers(users, terms, limit), nil
+}
+
+func (r *memoryUserRepository) Update(user *models.User, columns ...string) error {
+	return r.update(user, false, columns)
+}
+
+func (r *memoryUserRepository) UpdateIfVersion(user *models.User, columns ...string) error {
+	return r.update(user, true, columns)
+}
+
+/**
+ * Function to save the columns, a versioned write checks and increments the version of the user
+ */
+func (r *memoryUserRepository) update(user *models.User, versioned bool, columns []string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	stored, ok := r.db.users[user.ID]
+	if !ok || stored.DeletedAt.Valid {
+		return ErrNotFound
+	}
+	if versioned && stored.Version != user.Version {
+		return ErrConflict
+	}
+	if r.emailTaken(user) {
+		return ErrEmailTaken
+	}
+	user.UpdatedAt = time.Now()
+	if versioned {
+		user.Version = stored.Version + 1
+	} else {
+		user.Version = stored.Version
+	}
+	if len(columns) == 0 {
+		stored = *user
+	} else if err := copyColumns(&stored, user, append(columns, "updated_at", "version")); err != nil {
+		return err
+	}
+	r.db.users[user.ID] = stored
+	return nil
+}
+
+/**
+ * Function to tell whether another user has the email of the user, like the unique index of the database
+ * deleted users and empty emails are left out. The lock must be held
+ */
+func (r *memoryUserRepository) emailTaken(user *models.User) bool {
+	if user.Email == "" {
+		return false
+	}
+	for _, existing := range r.db.users {
+		if existing.ID != user.ID && !existing.DeletedAt.Valid && existing.Email == user.Email {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *memoryUserRepository) Delete(id uint) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	user, ok := r.db.users[id]
+	if !ok || user.DeletedAt.Valid {
+		return ErrNotFound
+	}
+	user.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	r.db.users[id] = user
+	return nil
+}
+
+func (r *memoryUserRepository) DeleteIfVersion(id uint, version uint) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	user, ok := r.db.users[id]
+	if !ok || user.DeletedAt.Valid {
+		return ErrNotFound
+	}
+	if user.Version != version {
+		return ErrConflict
+	}
+	user.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	r.db.users[id] = user
+	return nil
+}
+
+func (r *memoryUserRepository) IncrementFailedLogins(user *models.User, lockout Lockout) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	stored, ok := r.db.users[user.ID]
+	if !ok || stored.DeletedAt.Valid {
+		return ErrNotFound
+	}
+	stored.FailedLoginAttempts++
+	if lockedUntil := lockout.LockedUntil(stored.FailedLoginAttempts, time.Now()); lockedUntil != nil {
+		stored.LockedUntil = lockedUntil
+	}
+	r.db.users[user.ID] = stored
+	*user = stored
+	return nil
+}
+
+func (r *memoryUserRepository) UseTOTPStep(userID uint, step int64) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	stored, ok := r.db.users[userID]
+	if !ok || stored.DeletedAt.Valid || stored.TOTPLastStep >= step {
+		return false, nil
+	}
+	stored.TOTPLastStep = step
+	r.db.users[userID] = stored
+	return true, nil
+}
+
+type memorySessionRepository struct {
+	db *memoryDB
+}
+
+func (r *memorySessionRepository) Create(session *models.Session) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	r.db.lastSessionID++
+	now := time.Now()
+	session.ID = r.db.lastSessionID
+	session.CreatedAt = now
+	session.UpdatedAt = now
+	r.db.sessions[session.ID] = *session
+	return nil
+}
+
+func (r *memorySessionRepository) FindByID(id uint) (*models.Session, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	session, ok := r.db.sessions[id]
+	if !ok || session.DeletedAt.Valid {
+		return nil, ErrNotFound
+	}
+	return &session, nil
+}
+
+func (r *memorySessionRepository) ListActive(userID uint) ([]models.Session, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	now := time.Now()
+	var sessions []models.Session
+	for _, session := range r.db.sessions {
+		if session.UserID == userID && session.RevokedAt == nil && session.ExpiresAt.After(now) && !session.DeletedAt.Valid {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt) })
+	return sessions, nil
+}
+
+func (r *memorySessionRepository) Update(session *models.Session, columns ...string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	stored, ok := r.db.sessions[session.ID]
+	if !ok || stored.DeletedAt.Valid {
+		return ErrNotFound
+	}
+	session.UpdatedAt = time.Now()
+	if len(columns) == 0 {
+		stored = *session
+	} else if err := copyColumns(&stored, session, append(columns, "updated_at")); err != nil {
+		return err
+	}
+	r.db.sessions[session.ID] = stored
+	return nil
+}
+
+func (r *memorySessionRepository) Revoke(sessionID uint) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	r.db.revokeSessions(time.Now(), func(session models.Session) bool { return session.ID == sessionID })
+	return nil
+}
+
+func (r *memorySessionRepository) RevokeAll(userID uint, exceptSessionID uint) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	r.db.revokeSessions(time.Now(), func(session models.Session) bool {
+		return session.UserID == userID && session.ID != exceptSessionID
+	})
+	return nil
+}
+
+/**
+ * Function to revoke the matching sessions and their refresh tokens, the lock must be held
+ */
+func (db *memoryDB) revokeSessions(now time.Time, match func(session models.Session) bool) {
+	revoked := map[uint]bool{}
+	for id, session := range db.sessions {
+		if !match(session) {
+			continue
+		}
+		revoked[id] = true
+		if session.RevokedAt == nil {
+			session.RevokedAt = &now
+			db.sessions[id] = session
+		}
+	}
+	for id, token := range db.refreshTokens {
+		if revoked[token.SessionID] && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			db.refreshTokens[id] = token
+		}
+	}
+}
+
+type memoryTokenRepository struct {
+	db *memoryDB
+}
+
+func (r *memoryTokenRepository) CreateRefreshToken(token *models.RefreshToken) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, existing := range r.db.refreshTokens {
+		if existing.TokenHash == token.TokenHash {
+			return ErrDuplicate
+		}
+	}
+	r.db.lastRefreshTokenID++
+	now := time.Now()
+	token.ID = r.db.lastRefreshTokenID
+	token.CreatedAt = now
+	token.UpdatedAt = now
+	r.db.refreshTokens[token.ID] = *token
+	return nil
+}
+
+func (r *memoryTokenRepository) FindRefreshToken(tokenHash string) (*models.RefreshToken, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, token := range r.db.refreshTokens {
+		if token.TokenHash == tokenHash {
+			return &token, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryTokenRepository) UseRefreshToken(id uint) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	token, ok := r.db.refreshTokens[id]
+	if !ok || token.RevokedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	token.RevokedAt = &now
+	r.db.refreshTokens[id] = token
+	return true, nil
+}
+
+func (r *memoryTokenRepository) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	// Drop denylist entries of tokens that have expired on their own
+	now := time.Now()
+	for revokedJTI, revokedExpiresAt := range r.db.revokedTokens {
+		if revokedExpiresAt.Before(now) {
+			delete(r.db.revokedTokens, revokedJTI)
+		}
+	}
+	if _, ok := r.db.revokedTokens[jti]; !ok {
+		r.db.revokedTokens[jti] = expiresAt
+	}
+	return nil
+}
+
+func (r *memoryTokenRepository) IsAccessTokenRevoked(jti string) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	_, ok := r.db.revokedTokens[jti]
+	return ok, nil
+}
+
+func (r *memoryTokenRepository) UseMFAChallenge(jti string, expiresAt time.Time) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	// Used challenges share the denylist of the revoked access tokens
+	if _, ok := r.db.revokedTokens[jti]; ok {
+		return false, nil
+	}
+	r.db.revokedTokens[jti] = expiresAt
+	return true, nil
+}
+
+type memoryPasswordResetRepository struct {
+	db *memoryDB
+}
+
+func (r *memoryPasswordResetRepository) Create(token *models.PasswordResetToken) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	r.db.lastResetTokenID++
+	now := time.Now()
+	token.ID = r.db.lastResetTokenID
+	token.CreatedAt = now
+	token.UpdatedAt = now
+	r.db.resetTokens[token.ID] = *token
+	return nil
+}
+
+func (r *memoryPasswordResetRepository) InvalidateAll(userID uint) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	now := time.Now()
+	for id, token := range r.db.resetTokens {
+		if token.UserID == userID && token.UsedAt == nil {
+			token.UsedAt = &now
+			r.db.resetTokens[id] = token
+		}
+	}
+	return nil
+}
+
+func (r *memoryPasswordResetRepository) Use(tokenHash string) (*models.PasswordResetToken, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	now := time.Now()
+	for id, token := range r.db.resetTokens {
+		if token.TokenHash == tokenHash && token.UsedAt == nil && token.ExpiresAt.After(now) {
+			token.UsedAt = &now
+			r.db.resetTokens[id] = token
+			return &token, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+type memoryRecoveryCodeRepository struct {
+	db *memoryDB
+}
+
+func (r *memoryRecoveryCodeRepository) Replace(userID uint, codeHashes []string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	r.db.deleteRecoveryCodes(userID)
+	now := time.Now()
+	for _, codeHash := range codeHashes {
+		r.db.lastRecoveryCodeID++
+		code := models.RecoveryCode{UserID: userID, CodeHash: codeHash}
+		code.ID = r.db.lastRecoveryCodeID
+		code.CreatedAt = now
+		code.UpdatedAt = now
+		r.db.recoveryCodes[code.ID] = code
+	}
+	return nil
+}
+
+func (r *memoryRecoveryCodeRepository) Use(userID uint, codeHash string) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	now := time.Now()
+	for id, code := range r.db.recoveryCodes {
+		if code.UserID == userID && code.CodeHash == codeHash && code.UsedAt == nil {
+			code.UsedAt = &now
+			r.db.recoveryCodes[id] = code
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryRecoveryCodeRepository) DeleteAll(userID uint) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	r.db.deleteRecoveryCodes(userID)
+	return nil
+}
+
+/**
+ * Function to delete the recovery codes of the user, the lock must be held
+ */
+func (db *memoryDB) deleteRecoveryCodes(userID uint) {
+	for id, code := range db.recoveryCodes {
+		if code.UserID == userID {
+			delete(db.recoveryCodes, id)
+		}
+	}
+}
+
+// memoryHealthChecker reports the in-memory store as always healthy, it has no connection to lose
+type memoryHealthChecker struct{}
+
+func (memoryHealthChecker) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (memoryHealthChecker) PendingMigrations(ctx context.Context) (int, error) {
+	return 0, nil
+}
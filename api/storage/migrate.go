@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Key of the postgres advisory lock held while migrating, so replicas starting together migrate one at a time
+const migrationLockKey = 5813740291
+
+// Migration is a reversible change of the schema, applied in the order of its version
+type Migration struct {
+	Version uint
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration records an applied migration in the schema_migrations table
+type SchemaMigration struct {
+	Version   uint `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// MigrationStatus tells whether a migration is applied, AppliedAt is nil for pending migrations
+type MigrationStatus struct {
+	Version   uint
+	Name      string
+	AppliedAt *time.Time
+}
+
+/**
+ * Function to run the migration step in a transaction holding the migration lock
+ */
+func withMigrationLock(db *gorm.DB, step func(tx *gorm.DB, applied map[uint]SchemaMigration) error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		// The lock is released with the transaction, sqlite transactions already have a single writer
+		if tx.Dialector.Name() == "postgres" {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockKey).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.AutoMigrate(&SchemaMigration{}); err != nil {
+			return err
+		}
+		applied, err := appliedMigrations(tx)
+		if err != nil {
+			return err
+		}
+		return step(tx, applied)
+	})
+}
+
+/**
+ * Function to get the applied migrations by version
+ */
+func appliedMigrations(db *gorm.DB) (map[uint]SchemaMigration, error) {
+	var records []SchemaMigration
+	if err := db.Find(&records).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[uint]SchemaMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+/**
+ * Function to apply the pending migrations, returns the applied ones
+ */
+func MigrateUp(db *gorm.DB) ([]Migration, error) {
+	var done []Migration
+	err := withMigrationLock(db, func(tx *gorm.DB, applied map[uint]SchemaMigration) error {
+		for _, migration := range migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := migration.Up(tx); err != nil {
+				return fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+			}
+			record := SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}
+			if err := tx.Create(&record).Error; err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return done, nil
+}
+
+/**
+ * Function to roll back the given number of the latest applied migrations, returns the rolled back ones
+ */
+func MigrateDown(db *gorm.DB, steps int) ([]Migration, error) {
+	var done []Migration
+	err := withMigrationLock(db, func(tx *gorm.DB, applied map[uint]SchemaMigration) error {
+		// Every applied version must be known, or the migrations after it could not be undone in order
+		for version := range applied {
+			if findMigration(version) == nil {
+				return fmt.Errorf("applied migration %d is unknown to this build", version)
+			}
+		}
+		for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if err := migration.Down(tx); err != nil {
+				return fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+			}
+			if err := tx.Delete(&SchemaMigration{}, migration.Version).Error; err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return done, nil
+}
+
+/**
+ * Function to get the status of every migration, in the order they are applied
+ */
+func MigrationStatuses(db *gorm.DB) ([]MigrationStatus, error) {
+	// Nothing is applied before the migrations table exists
+	applied := map[uint]SchemaMigration{}
+	if db.Migrator().HasTable(&SchemaMigration{}) {
+		var err error
+		if applied, err = appliedMigrations(db); err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if record, ok := applied[migration.Version]; ok {
+			appliedAt := record.AppliedAt
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+/**
+ * Function to find the migration of the version, nil when there is none
+ */
+func findMigration(version uint) *Migration {
+	for i := range migrations {
+		if migrations[i].Version == version {
+			return &migrations[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migrations of the schema in the order they are applied, an applied migration must never change,
+// fix it with a new one instead
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_tables",
+		// Databases created by AutoMigrate before the migrations existed are adopted as they are
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(initialTables...)
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(initialTables...)
+		},
+	},
+	{
+		Version: 2,
+		Name:    "create_user_search_indexes",
+		Up:      migrateSearch,
+		Down:    dropSearch,
+	},
+	{
+		Version: 3,
+		Name:    "add_user_version",
+		// Existing users start at the first version
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&versionedUser{}, "Version")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&versionedUser{}, "Version")
+		},
+	},
+	{
+		Version: 4,
+		Name:    "add_user_totp_last_step",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&totpStepUser{}, "TOTPLastStep")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&totpStepUser{}, "TOTPLastStep")
+		},
+	},
+	{
+		Version: 5,
+		Name:    "create_user_email_unique_index",
+		// Users sharing an email must be fixed by hand before, the reset mail can only go to one of them
+		Up: func(tx *gorm.DB) error {
+			return tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_unique ON users (email) WHERE email <> '' AND deleted_at IS NULL`).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Exec(`DROP INDEX IF EXISTS idx_users_email_unique`).Error
+		},
+	},
+}
+
+// The tables as the first migration created them, the models are copied so later changes of the models
+// don't change the migration
+type initialUser struct {
+	gorm.Model
+	UserName    string `gorm:"uniqueIndex"`
+	Password    string
+	FullName    string
+	Email       string `gorm:"index"`
+	Dob         *time.Time
+	LinkedinURL string
+	Role        string `gorm:"default:member"`
+	TOTPSecret  string
+	MFAEnabled  bool
+
+	FailedLoginAttempts int
+	LockedUntil         *time.Time
+}
+
+func (initialUser) TableName() string {
+	return "users"
+}
+
+type initialSession struct {
+	gorm.Model
+	UserID     uint `gorm:"index"`
+	DeviceName string
+	UserAgent  string
+	IP         string
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	RevokedAt  *time.Time
+}
+
+func (initialSession) TableName() string {
+	return "sessions"
+}
+
+type initialRefreshToken struct {
+	gorm.Model
+	UserID    uint   `gorm:"index"`
+	SessionID uint   `gorm:"index"`
+	TokenHash string `gorm:"uniqueIndex"`
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+}
+
+func (initialRefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+type initialRevokedToken struct {
+	gorm.Model
+	JTI       string `gorm:"uniqueIndex"`
+	ExpiresAt time.Time
+}
+
+func (initialRevokedToken) TableName() string {
+	return "revoked_tokens"
+}
+
+type initialPasswordResetToken struct {
+	gorm.Model
+	UserID    uint   `gorm:"index"`
+	TokenHash string `gorm:"uniqueIndex"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+func (initialPasswordResetToken) TableName() string {
+	return "password_reset_tokens"
+}
+
+type initialRecoveryCode struct {
+	gorm.Model
+	UserID   uint   `gorm:"index"`
+	CodeHash string `gorm:"index"`
+	UsedAt   *time.Time
+}
+
+func (initialRecoveryCode) TableName() string {
+	return "recovery_codes"
+}
+
+// The version column as the third migration added it
+type versionedUser struct {
+	Version uint `gorm:"not null;default:1"`
+}
+
+func (versionedUser) TableName() string {
+	return "users"
+}
+
+// The totp step column as the fourth migration added it
+type totpStepUser struct {
+	TOTPLastStep int64 `gorm:"not null;default:0"`
+}
+
+func (totpStepUser) TableName() string {
+	return "users"
+}
+
+var initialTables = []interface{}{
+	&initialUser{},
+	&initialSession{},
+	&initialRefreshToken{},
+	&initialRevokedToken{},
+	&initialPasswordResetToken{},
+	&initialRecoveryCode{},
+}
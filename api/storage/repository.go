@@ -0,0 +1,232 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"ionixx/api/limiter"
+	"ionixx/api/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrNotFound is returned when the record does not exist
+	ErrNotFound = errors.New("record not found")
+	// ErrDuplicate is returned when a unique field is already taken
+	ErrDuplicate = errors.New("duplicated key not allowed")
+	// ErrEmailTaken is returned when the email of a user is already the email of another user
+	ErrEmailTaken = errors.New("email already taken")
+	// ErrConflict is returned when the record was changed since it was read
+	ErrConflict = errors.New("record changed since it was read")
+)
+
+// UserRepository stores the users
+type UserRepository interface {
+	Create(user *models.User) error
+	FindByID(id uint) (*models.User, error)
+	FindByUserName(userName string) (*models.User, error)
+	FindByEmail(email string) (*models.User, error)
+	// List returns a page of the users matching the query and the number of users matching its filters
+	List(query UserQuery) ([]models.User, int64, error)
+	// Search returns the users matching the search, the best matches first
+	Search(search string, limit int) ([]models.UserSearchResult, error)
+	// Update saves the given columns of the user, or every column when none is given, without changing the version:
+	// it is for the password, mfa and lockout state that are not part of the profile
+	Update(user *models.User, columns ...string) error
+	// UpdateIfVersion saves the given columns of a profile write when the stored user still has the version of the user,
+	// ErrConflict otherwise, and loads the new version into the user
+	UpdateIfVersion(user *models.User, columns ...string) error
+	Delete(id uint) error
+	// DeleteIfVersion is Delete when the stored user still has the version, ErrConflict otherwise
+	DeleteIfVersion(id uint, version uint) error
+	// IncrementFailedLogins counts a failed login, locks the user by the lockout of the new count in the same write
+	// and loads both into the user
+	IncrementFailedLogins(user *models.User, lockout Lockout) error
+	// UseTOTPStep records the time step of an accepted totp code, only a step after the last recorded one gets true
+	UseTOTPStep(userID uint, step int64) (bool, error)
+}
+
+// Lockout locks an account once its failed logins reach the threshold, for a delay doubled on every further failure
+type Lockout struct {
+	Threshold int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+/**
+ * Function to get until when the lockout locks an account with the failed logins, nil while below the threshold
+ */
+func (l Lockout) LockedUntil(failures int, now time.Time) *time.Time {
+	delay := limiter.Delay(failures, l.Threshold, l.BaseDelay, l.MaxDelay)
+	if delay == 0 {
+		return nil
+	}
+	lockedUntil := now.Add(delay)
+	return &lockedUntil
+}
+
+// SessionRepository stores the login sessions
+type SessionRepository interface {
+	Create(session *models.Session) error
+	FindByID(id uint) (*models.Session, error)
+	// ListActive returns the sessions of the user that are neither revoked nor expired, the most recent first
+	ListActive(userID uint) ([]models.Session, error)
+	// Update saves the given columns of the session, or every column when none is given
+	Update(session *models.Session, columns ...string) error
+	// Revoke revokes the session together with its refresh tokens
+	Revoke(sessionID uint) error
+	// RevokeAll revokes every session of the user except the given one, together with their refresh tokens
+	RevokeAll(userID uint, exceptSessionID uint) error
+}
+
+// TokenRepository stores the refresh tokens and the denylist of revoked access tokens
+type TokenRepository interface {
+	CreateRefreshToken(token *models.RefreshToken) error
+	FindRefreshToken(tokenHash string) (*models.RefreshToken, error)
+	// UseRefreshToken revokes the refresh token, only one concurrent call gets true
+	UseRefreshToken(id uint) (bool, error)
+	// RevokeAccessToken denies the access token until it expires
+	RevokeAccessToken(jti string, expiresAt time.Time) error
+	IsAccessTokenRevoked(jti string) (bool, error)
+	// UseMFAChallenge uses up the mfa challenge token until it expires, only one concurrent call gets true
+	UseMFAChallenge(jti string, expiresAt time.Time) (bool, error)
+}
+
+// PasswordResetRepository stores the password reset tokens
+type PasswordResetRepository interface {
+	Create(token *models.PasswordResetToken) error
+	// InvalidateAll uses up every reset token of the user
+	InvalidateAll(userID uint) error
+	// Use uses up the unexpired reset token, only one concurrent call gets it
+	Use(tokenHash string) (*models.PasswordResetToken, error)
+}
+
+// RecoveryCodeRepository stores the mfa recovery codes
+type RecoveryCodeRepository interface {
+	// Replace deletes the recovery codes of the user and saves the new ones
+	Replace(userID uint, codeHashes []string) error
+	// Use uses up the recovery code, only one concurrent call gets true
+	Use(userID uint, codeHash string) (bool, error)
+	DeleteAll(userID uint) error
+}
+
+// HealthChecker reports whether the database behind the store can serve requests
+type HealthChecker interface {
+	// Ping checks the database answers before the context is done
+	Ping(ctx context.Context) error
+	// PendingMigrations returns the number of migrations not applied yet, the database is queried until the context is done
+	PendingMigrations(ctx context.Context) (int, error)
+}
+
+// Store groups the repositories the controllers and middlewares are built with
+type Store struct {
+	Users          UserRepository
+	Sessions       SessionRepository
+	Tokens         TokenRepository
+	PasswordResets PasswordResetRepository
+	RecoveryCodes  RecoveryCodeRepository
+	Health         HealthChecker
+
+	// db is the database of the gorm store, nil for the memory store
+	db *gorm.DB
+}
+
+/**
+ * Function to get the store running its statements with the context, so they are canceled
+ * and traced with the request. The memory store has no statements, it is returned as is
+ */
+func (s *Store) WithContext(ctx context.Context) *Store {
+	if s.db == nil {
+		return s
+	}
+	return NewGormStore(s.db.WithContext(ctx))
+}
+
+/**
+ * Function to get the connection pool of the store, nil for the memory store
+ */
+func (s *Store) ConnectionPool() (*sql.DB, error) {
+	if s.db == nil {
+		return nil, nil
+	}
+	return s.db.DB()
+}
+
+/**
+ * Function to close the database connections of the store
+ */
+func (s *Store) Close() error {
+	pool, err := s.ConnectionPool()
+	if err != nil || pool == nil {
+		return err
+	}
+	return pool.Close()
+}
+
+// UserQuery filters, sorts and pages the user list, zero values are ignored
+type UserQuery struct {
+	UserName    string
+	FullName    string
+	DobFrom     time.Time
+	DobBefore   time.Time
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+
+	// Sort is one of UserSortFields, the id breaks the ties
+	Sort string
+	Desc bool
+	// After is the position of the last user of the previous page, the offset is ignored when it is set
+	After  *UserCursor
+	Offset int
+	Limit  int
+}
+
+// UserCursor is the sort value and id of a user
+type UserCursor struct {
+	Value interface{}
+	ID    uint
+}
+
+// UserSortField is a field users can be sorted by
+type UserSortField struct {
+	// Time fields have time.Time values
+	Time bool
+	// Nullable fields sort their null values last in both directions
+	Nullable bool
+}
+
+// Fields allowed to sort the users by, every other field is rejected
+var UserSortFields = map[string]UserSortField{
+	"id":         {},
+	"user_name":  {},
+	"full_name":  {},
+	"dob":        {Time: true, Nullable: true},
+	"created_at": {Time: true},
+	"updated_at": {Time: true},
+}
+
+/**
+ * Function to get the value of the sort field of a user, nil for a null date of birth
+ */
+func UserSortValue(user models.User, field string) interface{} {
+	switch field {
+	case "id":
+		return user.ID
+	case "user_name":
+		return user.UserName
+	case "full_name":
+		return user.FullName
+	case "dob":
+		if user.Dob == nil {
+			return nil
+		}
+		return *user.Dob
+	case "created_at":
+		return user.CreatedAt
+	case "updated_at":
+		return user.UpdatedAt
+	}
+	return nil
+}
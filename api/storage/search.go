@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"html"
+	"ionixx/api/models"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// Text searched by the full text search, the expression must match the index exactly to use it
+const userSearchDocument = `to_tsvector('simple', coalesce(full_name, '') || ' ' || coalesce(user_name, '') || ' ' || coalesce(linkedin_url, ''))`
+
+// Indexes used by the user search on postgres
+var userSearchIndexes = []string{
+	`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+	`CREATE INDEX IF NOT EXISTS idx_users_search ON users USING gin ((` + userSearchDocument + `))`,
+	`CREATE INDEX IF NOT EXISTS idx_users_full_name_trgm ON users USING gin (full_name gin_trgm_ops)`,
+	`CREATE INDEX IF NOT EXISTS idx_users_user_name_trgm ON users USING gin (user_name gin_trgm_ops)`,
+	`CREATE INDEX IF NOT EXISTS idx_users_linkedin_url_trgm ON users USING gin (linkedin_url gin_trgm_ops)`,
+}
+
+// Markers ts_headline and rankUsers wrap the matches in, they become <mark> tags once the field is html escaped
+const (
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+)
+
+// Ranks and highlights the users matching the full text query or similar to the search
+const userSearchQuery = `
+SELECT users.*,
+	ts_rank(` + userSearchDocument + `, to_tsquery('simple', @tsquery))
+		+ greatest(word_similarity(@search, full_name), word_similarity(@search, user_name), word_similarity(@search, linkedin_url)) AS rank,
+	ts_headline('simple', full_name, to_tsquery('simple', @tsquery), @headline) AS highlight_full_name,
+	ts_headline('simple', user_name, to_tsquery('simple', @tsquery), @headline) AS highlight_user_name,
+	ts_headline('simple', linkedin_url, to_tsquery('simple', @tsquery), @headline) AS highlight_linkedin_url
+FROM users
+WHERE deleted_at IS NULL
+	AND (` + userSearchDocument + ` @@ to_tsquery('simple', @tsquery)
+		OR @search <% full_name OR @search <% user_name OR @search <% linkedin_url)
+ORDER BY rank DESC, id
+LIMIT @limit`
+
+/**
+ * Function to create the indexes of the user search
+ */
+func migrateSearch(db *gorm.DB) error {
+	// Only postgres has full text and trigram indexes
+	if db.Dialector.Name() != "postgres" {
+		return nil
+	}
+	for _, statement := range userSearchIndexes {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+ * Function to drop the indexes of the user search, the pg_trgm extension is left for other users of it
+ */
+func dropSearch(db *gorm.DB) error {
+	if db.Dialector.Name() != "postgres" {
+		return nil
+	}
+	for _, index := range []string{"idx_users_search", "idx_users_full_name_trgm", "idx_users_user_name_trgm", "idx_users_linkedin_url_trgm"} {
+		if err := db.Exec("DROP INDEX IF EXISTS " + index).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+ * Function to split the search into lower case words
+ */
+func searchTerms(search string) []string {
+	return strings.FieldsFunc(strings.ToLower(search), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+/**
+ * Function to search the users by full name, user name and linkedin url.
+ * Every word of the search matches as a prefix and misspelled words match by trigram similarity.
+ */
+func searchUsersGorm(db *gorm.DB, search string, limit int) ([]models.UserSearchResult, error) {
+	terms := searchTerms(search)
+	results := []models.UserSearchResult{}
+	if len(terms) == 0 {
+		return results, nil
+	}
+	if db.Dialector.Name() != "postgres" {
+		return searchUsersLike(db, terms, limit)
+	}
+
+	result := db.Raw(userSearchQuery, map[string]interface{}{
+		"tsquery":  strings.Join(terms, ":* & ") + ":*",
+		"search":   strings.Join(terms, " "),
+		"headline": `StartSel="` + highlightStart + `", StopSel="` + highlightStop + `", HighlightAll=true`,
+		"limit":    limit,
+	}).Scan(&results)
+	for i := range results {
+		results[i].Highlight = escapeHighlight(results[i].Highlight)
+	}
+	return results, result.Error
+}
+
+/**
+ * Function to search the users with like on databases without full text search.
+ * Every word of the search must be contained in one of the fields, it is meant for development and tests.
+ */
+func searchUsersLike(db *gorm.DB, terms []string, limit int) ([]models.UserSearchResult, error) {
+	var users []models.User
+	query := db.Model(&models.User{})
+	for _, term := range terms {
+		like := "%" + term + "%"
+		query = query.Where("(lower(full_name) like ? or lower(user_name) like ? or lower(linkedin_url) like ?)", like, like, like)
+	}
+	if err := query.Order("id").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return rankUsers(users, terms, limit), nil
+}
+
+/**
+ * Function to rank and highlight the users containing the words, the best matches first
+ */
+func rankUsers(users []models.User, terms []string, limit int) []models.UserSearchResult {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = regexp.QuoteMeta(term)
+	}
+	matcher := regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+
+	results := make([]models.UserSearchResult, 0, len(users))
+	for _, user := range users {
+		result := models.UserSearchResult{User: user}
+		// Every field a word is found in adds to the rank
+		for _, field := range []string{user.FullName, user.UserName, user.LinkedinURL} {
+			result.Rank += float64(len(matcher.FindAllStringIndex(field, -1))) / float64(len(terms))
+		}
+		marks := highlightStart + "$0" + highlightStop
+		result.Highlight = escapeHighlight(models.UserHighlight{
+			FullName:    matcher.ReplaceAllString(user.FullName, marks),
+			UserName:    matcher.ReplaceAllString(user.UserName, marks),
+			LinkedinURL: matcher.ReplaceAllString(user.LinkedinURL, marks),
+		})
+		results = append(results, result)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Rank > results[j].Rank
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+/**
+ * Function to html escape the highlighted fields and turn their markers into <mark> tags,
+ * the fields hold what users typed so they must not reach a client as html
+ */
+func escapeHighlight(highlight models.UserHighlight) models.UserHighlight {
+	marks := strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>")
+	escape := func(field string) string {
+		return marks.Replace(html.EscapeString(field))
+	}
+	return models.UserHighlight{
+		FullName:    escape(highlight.FullName),
+		UserName:    escape(highlight.UserName),
+		LinkedinURL: escape(highlight.LinkedinURL),
+	}
+}
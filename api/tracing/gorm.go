@@ -0,0 +1,90 @@
+package tracing
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// Key of the span of a statement in the gorm instance
+const gormSpanKey = "tracing:span"
+
+// gormCallback is a callback position in the chain of a gorm operation
+type gormCallback interface {
+	Register(name string, fn func(*gorm.DB)) error
+}
+
+// GormPlugin starts a span for every SQL statement, a child of the span in the context of the statement
+type GormPlugin struct{}
+
+/**
+ * Function to get the name of the plugin
+ */
+func (GormPlugin) Name() string {
+	return "tracing"
+}
+
+/**
+ * Function to register the callbacks starting and ending the spans around every gorm operation
+ */
+func (GormPlugin) Initialize(db *gorm.DB) error {
+	register := func(operation string, before gormCallback, after gormCallback) error {
+		if err := before.Register("tracing:before_"+operation, startStatement(operation)); err != nil {
+			return err
+		}
+		return after.Register("tracing:after_"+operation, endStatement)
+	}
+
+	callback := db.Callback()
+	for _, err := range []error{
+		register("create", callback.Create().Before("gorm:create"), callback.Create().After("gorm:create")),
+		register("query", callback.Query().Before("gorm:query"), callback.Query().After("gorm:query")),
+		register("update", callback.Update().Before("gorm:update"), callback.Update().After("gorm:update")),
+		register("delete", callback.Delete().Before("gorm:delete"), callback.Delete().After("gorm:delete")),
+		register("row", callback.Row().Before("gorm:row"), callback.Row().After("gorm:row")),
+		register("raw", callback.Raw().Before("gorm:raw"), callback.Raw().After("gorm:raw")),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+ * Function to get the callback starting the span of a statement of the operation
+ */
+func startStatement(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		_, span := Start(db.Statement.Context, "gorm."+operation, trace.WithSpanKind(trace.SpanKindClient))
+		db.InstanceSet(gormSpanKey, span)
+	}
+}
+
+/**
+ * Function to end the span of the statement with the SQL and its outcome, the SQL has placeholders instead of the values
+ */
+func endStatement(db *gorm.DB) {
+	value, ok := db.InstanceGet(gormSpanKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+	defer span.End()
+
+	span.SetAttributes(
+		semconv.DBSystemKey.String(db.Dialector.Name()),
+		semconv.DBStatement(db.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", db.RowsAffected),
+	)
+	if db.Statement.Table != "" {
+		span.SetAttributes(semconv.DBSQLTable(db.Statement.Table))
+	}
+	// A missing record is an answer, not a failure
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		RecordError(span, db.Error)
+	}
+}
@@ -0,0 +1,179 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"ionixx/api/config"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name of the tracer of the server spans
+const instrumentationName = "ionixx"
+
+// Suffixes the compiler adds to the names of method values and closures
+var funcSuffix = regexp.MustCompile(`(-fm|\.func\d+)+$`)
+
+/**
+ * Function to install the tracer provider exporting to the configured exporter and the W3C trace context propagator.
+ * The returned function flushes the spans left and must be called before the process exits
+ */
+func Init(cfg config.TracingConfig) (func(ctx context.Context) error, error) {
+	// Incoming traceparent headers are continued even when nothing is exported
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var closeFile func() error
+	switch cfg.Exporter {
+	case "none":
+		return func(ctx context.Context) error { return nil }, nil
+	case "stdout":
+		stdout, err := stdouttrace.New()
+		if err != nil {
+			return nil, err
+		}
+		exporter = stdout
+	case "file":
+		file, err := os.OpenFile(cfg.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("opening trace file: %w", err)
+		}
+		stdout, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		exporter, closeFile = stdout, file.Close
+	case "otlp":
+		options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.OTLPEndpoint)}
+		if cfg.OTLPInsecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		// The client connects lazily, an unreachable collector doesn't stop the server from starting
+		otlp, err := otlptracehttp.New(context.Background(), options...)
+		if err != nil {
+			return nil, err
+		}
+		exporter = otlp
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(cfg.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closeFile != nil {
+			if closeErr := closeFile(); err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	}, nil
+}
+
+/**
+ * Function to start a span of the server, it is a child of the span in the context
+ */
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+/**
+ * Function to mark the span as failed with the error
+ */
+func RecordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+/**
+ * Function to get the middleware starting the span of every request, it continues the trace of the traceparent header
+ * and returns the traceparent of the request span so the client can find the trace
+ */
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		propagator := otel.GetTextMapPropagator()
+		ctx := propagator.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		// Requests matching no route share one name so unknown paths can't grow the span names
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		ctx, span := Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethod(c.Request.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(c.Request.URL.Path),
+				semconv.UserAgentOriginal(c.Request.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		propagator.Inject(ctx, propagation.HeaderCarrier(c.Writer.Header()))
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPStatusCode(status))
+		// Client errors are the client's fault, only server errors fail the span
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
+
+/**
+ * Function to wrap a middleware or controller handler in a span named after the handler,
+ * e.g. controllers.UserController.GetUserByID. A wrapped middleware must not call c.Next,
+ * or its span covers the handlers after it
+ */
+func Handler(handler gin.HandlerFunc) gin.HandlerFunc {
+	name := HandlerName(handler)
+	return func(c *gin.Context) {
+		parent := c.Request.Context()
+		ctx, span := Start(parent, name)
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		handler(c)
+		// The next handlers are siblings of this one, not its children
+		c.Request = c.Request.WithContext(parent)
+
+		if c.IsAborted() {
+			span.SetAttributes(attribute.Bool("gin.aborted", true))
+		}
+	}
+}
+
+/**
+ * Function to get the package qualified name of a handler function, closures are named after the function returning them
+ */
+func HandlerName(handler gin.HandlerFunc) string {
+	name := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	name = funcSuffix.ReplaceAllString(name, "")
+	return strings.NewReplacer("(*", "", ")", "").Replace(name)
+}
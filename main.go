@@ -1,86 +1,259 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"ionixx/api/config"
 	"ionixx/api/controllers"
+	"ionixx/api/logging"
+	"ionixx/api/metrics"
 	"ionixx/api/middlewares"
+	"ionixx/api/models"
+	"ionixx/api/notify"
+	"ionixx/api/signing"
 	"ionixx/api/storage"
+	"ionixx/api/tracing"
+	"log/slog"
 	"os"
 
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
 )
 
 /**
  * Function to setup the user router
  */
-func setupUserRouter(r *gin.Engine) {
+func setupUserRouter(r *gin.Engine, store *storage.Store, cfg *config.Config, keys *signing.KeySet, passwordController *controllers.PasswordController) {
 	// create the user controller
-	userController := &controllers.UserController{}
+	userController := controllers.NewUserController(store, cfg.Auth)
+	// create the auth middleware
+	authMiddleware := tracing.Handler(middlewares.AuthMiddleware(store, keys))
 
 	// create the user router group
 	userRouter := r.Group("/user")
 
 	// user routes
-	userRouter.GET("/", userController.GetAllUsers)
-	userRouter.POST("/", userController.CreateUser)
+	userRouter.GET("/", tracing.Handler(userController.GetAllUsers))
+	userRouter.POST("/", tracing.Handler(userController.CreateUser))
 
 	//use auth middleware for all user routes below
-	userRouter.Use(middlewares.AuthMiddleware)
+	userRouter.Use(authMiddleware)
 	{
-		userRouter.GET("/:id", userController.GetUserByID)
-		userRouter.PUT("/:id", userController.UpdateUserById)
-		userRouter.DELETE("/:id", userController.DeleteUserById)
+		userRouter.GET("/search", tracing.Handler(userController.SearchUsers))
+		userRouter.GET("/:id", tracing.Handler(userController.GetUserByID))
+		// members can only modify themselves, admins can modify everyone
+		userRouter.PUT("/:id", tracing.Handler(middlewares.SelfOrAdmin), tracing.Handler(userController.UpdateUserById))
+		userRouter.PATCH("/:id", tracing.Handler(middlewares.SelfOrAdmin), tracing.Handler(userController.PatchUserById))
+		userRouter.DELETE("/:id", tracing.Handler(middlewares.SelfOrAdmin), tracing.Handler(userController.DeleteUserById))
+		// users can only change their own password
+		userRouter.PUT("/:id/password", tracing.Handler(middlewares.Self), tracing.Handler(passwordController.ChangePassword))
+		// only admins can change roles and unlock users
+		userRouter.PUT("/:id/role", tracing.Handler(middlewares.RequireRole(models.RoleAdmin)), tracing.Handler(userController.UpdateUserRole))
+		userRouter.POST("/:id/unlock", tracing.Handler(middlewares.RequireRole(models.RoleAdmin)), tracing.Handler(userController.UnlockUser))
+	}
+}
+
+/**
+ * Function to setup the router of the logged in user, the routes never take the id of the user
+ */
+func setupMeRouter(r *gin.Engine, store *storage.Store, cfg *config.Config, keys *signing.KeySet, passwordController *controllers.PasswordController) {
+	// create the user and session controllers
+	userController := controllers.NewUserController(store, cfg.Auth)
+	sessionController := controllers.NewSessionController(store)
+	// create the auth middleware
+	authMiddleware := tracing.Handler(middlewares.AuthMiddleware(store, keys))
+
+	// every me route requires a valid token
+	meRouter := r.Group("/me", authMiddleware)
+	{
+		meRouter.GET("", tracing.Handler(userController.GetMe))
+		meRouter.PUT("", tracing.Handler(userController.UpdateMe))
+		meRouter.PATCH("", tracing.Handler(userController.PatchMe))
+		meRouter.DELETE("", tracing.Handler(userController.DeleteMe))
+		// the password and session handlers only act on the logged in user
+		meRouter.PUT("/password", tracing.Handler(passwordController.ChangePassword))
+		meRouter.GET("/sessions", tracing.Handler(sessionController.GetSessions))
+		meRouter.DELETE("/sessions/:id", tracing.Handler(sessionController.RevokeSession))
 	}
 }
 
 /**
  * Function to setup the auth router
  */
-func setupAuthRouter(r *gin.Engine) {
+func setupAuthRouter(r *gin.Engine, store *storage.Store, cfg *config.Config, keys *signing.KeySet, passwordController *controllers.PasswordController) {
 	// create the auth controller
-	authController := &controllers.AuthController{}
+	authController := controllers.NewAuthController(store, cfg.Auth, keys)
+	// create the auth middleware
+	authMiddleware := tracing.Handler(middlewares.AuthMiddleware(store, keys))
 	// create the auth router group
 	authRouter := r.Group("/auth")
 	// auth routes
-	authRouter.POST("/login", authController.Login)
+	authRouter.POST("/login", tracing.Handler(authController.Login))
+	authRouter.POST("/refresh", tracing.Handler(authController.Refresh))
+	authRouter.POST("/revoke", tracing.Handler(authController.Revoke))
+	authRouter.POST("/logout", authMiddleware, tracing.Handler(authController.Logout))
+	authRouter.POST("/logout/all", authMiddleware, tracing.Handler(authController.LogoutAll))
+
+	// password reset routes
+	authRouter.POST("/password/forgot", tracing.Handler(passwordController.ForgotPassword))
+	authRouter.POST("/password/reset", tracing.Handler(passwordController.ResetPassword))
+
+	// create the mfa controller
+	mfaController := controllers.NewMFAController(store, cfg.Auth, keys)
+	// the mfa challenge of login is completed without an access token
+	authRouter.POST("/mfa/verify", tracing.Handler(mfaController.Verify))
+	// mfa enrollment routes require a valid token
+	mfaRouter := authRouter.Group("/mfa", authMiddleware)
+	{
+		mfaRouter.POST("/enroll", tracing.Handler(mfaController.Enroll))
+		mfaRouter.POST("/confirm", tracing.Handler(mfaController.Confirm))
+		mfaRouter.POST("/disable", tracing.Handler(mfaController.Disable))
+	}
+
+	// create the session controller
+	sessionController := controllers.NewSessionController(store)
+	// session routes require a valid token
+	sessionRouter := authRouter.Group("/sessions", authMiddleware)
+	{
+		sessionRouter.GET("/", tracing.Handler(sessionController.GetSessions))
+		sessionRouter.DELETE("/:id", tracing.Handler(sessionController.RevokeSession))
+	}
 }
 
 /**
- * Function load environment variables from .env file
+ * Function to setup the well known router
  */
-func loadEnv() {
-	// load .env file
-	err := godotenv.Load(".env")
+func setupWellKnownRouter(r *gin.Engine, keys *signing.KeySet) {
+	// create the jwks controller
+	jwksController := controllers.NewJWKSController(keys)
+	// well known routes
+	r.GET("/.well-known/jwks.json", tracing.Handler(jwksController.GetJWKS))
+}
+
+/**
+ * Function to setup the health router, probed by the orchestrator
+ */
+func setupHealthRouter(r *gin.Engine, store *storage.Store, keys *signing.KeySet) {
+	// create the health controller
+	healthController := controllers.NewHealthController(store, keys)
+	// liveness and readiness routes
+	r.GET("/healthz", tracing.Handler(healthController.Liveness))
+	r.GET("/readyz", tracing.Handler(healthController.Readiness))
+}
 
-	// if there is an error, panic and exit
+/**
+ * Function to setup the metrics router, the connection pool statistics of the store are exported with the metrics
+ */
+func setupMetricsRouter(r *gin.Engine, store *storage.Store, cfg *config.Config) {
+	pool, err := store.ConnectionPool()
+	// if there is an error getting the connection pool, panic and exit
 	if err != nil {
-		panic("Error loading .env file")
+		panic(err)
+	}
+	// the memory store has no connection pool
+	if pool != nil {
+		if err := metrics.RegisterDBStats(pool, cfg.Database.Driver); err != nil {
+			panic(err)
+		}
 	}
+	// metrics route
+	r.GET("/metrics", metrics.Handler())
 }
 
 /**
- * Function to setup the server
+ * Function to setup the server with the loaded config and the logger. When the server stops the password controller
+ * must be drained, so the password resets still queued are sent, before the store is closed
  */
-func SetupServer() *gin.Engine {
-	// load environment variables
-	loadEnv()
+func SetupServer(cfg *config.Config, logger *slog.Logger) (*gin.Engine, *storage.Store, *controllers.PasswordController) {
+	// initialize the store of the configured driver
+	store := storage.InitStore(cfg.Database, logger)
 
-	// initialize the database
-	storage.InitDB()
+	// load the jwt signing keys
+	keys := signing.InitKeys(cfg.JWT, logger)
 
-	// initialize the server
-	r := gin.Default()
+	// initialize the notifier, the password controller shared by the routers sends the password resets with it
+	notifier := notify.InitNotifier(cfg.Notifier)
+	passwordController := controllers.NewPasswordController(store, cfg.Auth, notifier)
+
+	// initialize the server, the client ip is only taken from X-Forwarded-For behind the trusted proxies
+	r := gin.New()
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxyList()); err != nil {
+		panic(err)
+	}
+	// trace, log and count every request, the middlewares must be added before the routes.
+	// The logging middleware runs inside the trace so its lines carry the trace id
+	r.Use(tracing.Middleware(), logging.Middleware(logger), metrics.Middleware(), logging.Recovery())
 
 	// setup user router
-	setupUserRouter(r)
+	setupUserRouter(r, store, cfg, keys, passwordController)
+	// setup me router
+	setupMeRouter(r, store, cfg, keys, passwordController)
 	// setup auth router
-	setupAuthRouter(r)
+	setupAuthRouter(r, store, cfg, keys, passwordController)
+	// setup well known router
+	setupWellKnownRouter(r, keys)
+	// setup health router
+	setupHealthRouter(r, store, keys)
+	// setup metrics router
+	setupMetricsRouter(r, store, cfg)
 
 	// return the server
-	return r
+	return r, store, passwordController
 }
 
 func main() {
-	// initialize the server and start it
-	SetupServer().Run(":" + os.Getenv("PORT"))
+	// load the config from the defaults, the config file, the environment and the flags
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	// if the config is invalid, print why and exit
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	// log json lines to stdout, the logs of every package go through this logger
+	logger := logging.New(cfg.Log, os.Stdout)
+	slog.SetDefault(logger)
+
+	// run the migrate or promote subcommand instead of the server
+	if len(args) > 0 && (args[0] == "migrate" || args[0] == "promote") {
+		run := runMigrate
+		if args[0] == "promote" {
+			run = runPromote
+		}
+		if err := run(cfg, logger, args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// install the tracer provider of the configured exporter
+	shutdownTracing, err := tracing.Init(cfg.Tracing)
+	if err != nil {
+		logger.Error("Couldn't initialize tracing", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	// initialize the server and serve until it is stopped
+	r, store, passwordController := SetupServer(cfg, logger)
+	serveErr := runServer(newHTTPServer(cfg, r), cfg.Server.ShutdownTimeout, logger, passwordController.Drain)
+
+	// close the database connections once no request uses them
+	if err := store.Close(); err != nil {
+		logger.Error("Couldn't close the store", slog.String("error", err.Error()))
+	}
+	// export the spans of the last requests
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error("Couldn't flush the traces", slog.String("error", err.Error()))
+	}
+	cancel()
+	if serveErr != nil {
+		logger.Error("Server stopped", slog.String("error", serveErr.Error()))
+		os.Exit(1)
+	}
 }
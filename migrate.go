@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"ionixx/api/config"
+	"ionixx/api/storage"
+	"log/slog"
+	"strconv"
+)
+
+const migrateUsage = "usage: migrate up | down [steps] | status"
+
+/**
+ * Function to run the migrate subcommand: up applies the pending migrations,
+ * down rolls back the latest ones (one by default) and status lists every migration
+ */
+func runMigrate(cfg *config.Config, logger *slog.Logger, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	// open the database without migrating it
+	if cfg.Database.Driver == "memory" {
+		return errors.New("the memory store has no migrations")
+	}
+	db, err := storage.OpenDB(cfg.Database.Driver, cfg.Database.DSN, logger)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := storage.MigrateUp(db)
+		if err != nil {
+			return err
+		}
+		for _, migration := range applied {
+			fmt.Printf("Applied migration %d %s\n", migration.Version, migration.Name)
+		}
+		fmt.Printf("%d migrations applied\n", len(applied))
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("steps must be a positive number, %s", migrateUsage)
+			}
+		}
+		rolledBack, err := storage.MigrateDown(db, steps)
+		if err != nil {
+			return err
+		}
+		for _, migration := range rolledBack {
+			fmt.Printf("Rolled back migration %d %s\n", migration.Version, migration.Name)
+		}
+		fmt.Printf("%d migrations rolled back\n", len(rolledBack))
+	case "status":
+		statuses, err := storage.MigrationStatuses(db)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%4d  %-32s %s\n", status.Version, status.Name, applied)
+		}
+	default:
+		return errors.New(migrateUsage)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"ionixx/api/config"
+	"ionixx/api/controllers"
+	"ionixx/api/storage"
+	"log/slog"
+)
+
+const promoteUsage = "usage: promote <user_name>"
+
+/**
+ * Function to run the promote subcommand: the user gets the admin role,
+ * it creates the first admin of a deployment since only admins can change roles through the api
+ */
+func runPromote(cfg *config.Config, logger *slog.Logger, args []string) error {
+	if len(args) != 1 {
+		return errors.New(promoteUsage)
+	}
+
+	// open the database without migrating it
+	if cfg.Database.Driver == "memory" {
+		return errors.New("the memory store keeps no users between restarts")
+	}
+	db, err := storage.OpenDB(cfg.Database.Driver, cfg.Database.DSN, logger)
+	if err != nil {
+		return err
+	}
+	store := storage.NewGormStore(db)
+	defer store.Close()
+
+	user, err := controllers.PromoteToAdmin(store, args[0])
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("user %q not found", args[0])
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("User %s (id %d) is now an admin\n", user.UserName, user.ID)
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ionixx/api/config"
+	"log/slog"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+/**
+ * Function to create the http server of the handler with the configured timeouts
+ */
+func newHTTPServer(cfg *config.Config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Port),
+		Handler:           handler,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+}
+
+/**
+ * Function to serve until SIGINT or SIGTERM, then stop accepting connections
+ * and give the in-flight requests and the drained background work until the shutdown timeout to finish
+ */
+func runServer(server *http.Server, shutdownTimeout time.Duration, logger *slog.Logger, drain func(context.Context) error) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+	logger.Info("Listening", slog.String("addr", server.Addr))
+
+	select {
+	case err := <-serveErr:
+		// The server failed to start or stopped on its own
+		return err
+	case <-ctx.Done():
+	}
+	// A second signal kills the process right away
+	stop()
+	logger.Info("Shutting down, waiting for in-flight requests", slog.String("timeout", shutdownTimeout.String()))
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		// The deadline passed, drop the connections that are left
+		server.Close()
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	// The requests are done, finish the work they left in the background
+	if err := drain(shutdownCtx); err != nil {
+		return fmt.Errorf("drain: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package test
+
+import (
+	"ionixx/api/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+/**
+ * Function to test the config layers, the file is overridden by the environment and the environment by the flags
+ * case: success
+ */
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	file := "port: 4000\ndatabase:\n  driver: sqlite\n  dsn: file.db\nauth:\n  access_token_ttl: 10m\njwt:\n  ephemeral_keys: true\n"
+	if err := os.WriteFile(path, []byte(file), 0600); err != nil {
+		t.Fatalf("Couldn't write config file: %v\n", err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("PORT", "5000")
+	t.Setenv("DSN", "env.db")
+	t.Setenv("BCRYPT_COST", "")
+
+	cfg, args, err := config.Load([]string{"-port", "6000", "migrate", "status"})
+	if err != nil {
+		t.Fatalf("Couldn't load config: %v\n", err)
+	}
+	if cfg.Port != 6000 || cfg.Database.Driver != "sqlite" || cfg.Database.DSN != "env.db" {
+		t.Fatalf("Expected the flag, file and env values but instead got %+v\n", cfg)
+	}
+	if cfg.Auth.AccessTokenTTL != 10*time.Minute || cfg.Auth.BcryptCost != config.Default().Auth.BcryptCost {
+		t.Fatalf("Expected the file and default values but instead got %+v\n", cfg.Auth)
+	}
+	if len(args) != 2 || args[0] != "migrate" {
+		t.Fatalf("Expected the arguments after the flags but instead got %v\n", args)
+	}
+}
+
+/**
+ * Function to test invalid settings are reported together
+ * case: failed
+ */
+func TestLoadConfigInvalid(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("DB_DRIVER", "mysql")
+	t.Setenv("ACCESS_TOKEN_TTL", "forever")
+
+	_, _, err := config.Load(nil)
+	if err == nil || !strings.Contains(err.Error(), "ACCESS_TOKEN_TTL") {
+		t.Fatalf("Expected an error about ACCESS_TOKEN_TTL but instead got %v\n", err)
+	}
+
+	t.Setenv("ACCESS_TOKEN_TTL", "")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, proxy.local")
+	_, _, err = config.Load([]string{"-port", "0"})
+	if err == nil || !strings.Contains(err.Error(), "PORT must be") || !strings.Contains(err.Error(), "DB_DRIVER must be") {
+		t.Fatalf("Expected errors about PORT and DB_DRIVER but instead got %v\n", err)
+	}
+	if !strings.Contains(err.Error(), `TRUSTED_PROXIES must hold ips or cidrs, got "proxy.local"`) || strings.Contains(err.Error(), "10.0.0.0/8") {
+		t.Fatalf("Expected an error about the proxy.local proxy only but instead got %v\n", err)
+	}
+	// Without a key directory every replica would sign with its own key
+	if !strings.Contains(err.Error(), "JWT_KEYS_DIR is required") {
+		t.Fatalf("Expected an error about JWT_KEYS_DIR but instead got %v\n", err)
+	}
+}
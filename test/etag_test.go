@@ -0,0 +1,166 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"ionixx/api/controllers"
+	"ionixx/api/models"
+	"ionixx/api/response"
+	"ionixx/api/storage"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+/**
+ * Function to perform a request with a conditional header
+ */
+func performConditional(r *gin.Engine, t *testing.T, method string, path string, header string, etag string, body []byte) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, path, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Couldn't create request: %v\n", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if etag != "" {
+		req.Header.Set(header, etag)
+	}
+
+	// Create a response recorder to inspect the response
+	w := httptest.NewRecorder()
+
+	// Perform the request
+	r.ServeHTTP(w, req)
+	fmt.Println(w.Body)
+	return w
+}
+
+/**
+ * Function to test the ETag of a user
+ * case: success, reads are not modified until a write and stale writes fail their precondition
+ */
+func TestUserETag(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	userController := controllers.NewUserController(store, TestAuthConfig)
+	r.GET("/:id", userController.GetUserByID)
+	r.PUT("/:id", userController.UpdateUserById)
+	r.DELETE("/:id", userController.DeleteUserById)
+	user := CreateTestUser(t, store, "tagged", "tagged#123", models.RoleMember)
+	path := fmt.Sprintf("/%d", user.ID)
+
+	w := performConditional(r, t, http.MethodGet, path, "", "", nil)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Expected a user with an ETag but instead got %d %q\n", w.Code, etag)
+	}
+	w = performConditional(r, t, http.MethodGet, path, "If-None-Match", etag, nil)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusNotModified, w.Code)
+	}
+
+	// The first admin saves with the ETag the user was read with
+	data, _ := json.Marshal(controllers.UpdateUserRequest{FullName: "First Admin"})
+	w = performConditional(r, t, http.MethodPut, path, "If-Match", etag, data)
+	updated := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || updated == "" || updated == etag {
+		t.Fatalf("Expected the update to change the ETag but instead got %d %q\n", w.Code, updated)
+	}
+
+	// The second admin read the user before the first one saved
+	data, _ = json.Marshal(controllers.UpdateUserRequest{FullName: "Second Admin"})
+	w = performConditional(r, t, http.MethodPut, path, "If-Match", etag, data)
+	decodeProblem(t, w, http.StatusPreconditionFailed, response.CodePreconditionFailed)
+	w = performConditional(r, t, http.MethodDelete, path, "If-Match", etag, nil)
+	decodeProblem(t, w, http.StatusPreconditionFailed, response.CodePreconditionFailed)
+	stored, _ := store.Users.FindByID(user.ID)
+	if stored.FullName != "First Admin" {
+		t.Fatalf("Expected the first update to be kept but instead got %s\n", stored.FullName)
+	}
+
+	// The old ETag is no longer current
+	w = performConditional(r, t, http.MethodGet, path, "If-None-Match", etag, nil)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != updated {
+		t.Fatalf("Expected the updated user but instead got %d %q\n", w.Code, w.Header().Get("ETag"))
+	}
+	w = performConditional(r, t, http.MethodDelete, path, "If-Match", updated, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+}
+
+/**
+ * Function to test the ETag of the user list
+ * case: success, the page is not modified until a user of it changes
+ */
+func TestUserListETag(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	userController := controllers.NewUserController(store, TestAuthConfig)
+	r.GET("/", userController.GetAllUsers)
+	user := CreateTestUser(t, store, "listed", "listed#123", models.RoleMember)
+
+	w := performConditional(r, t, http.MethodGet, "/", "", "", nil)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Expected a page with an ETag but instead got %d %q\n", w.Code, etag)
+	}
+	w = performConditional(r, t, http.MethodGet, "/", "If-None-Match", "W/"+etag, nil)
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusNotModified, w.Code)
+	}
+
+	user.FullName = "Listed User"
+	if err := store.Users.Update(&user, "full_name"); err != nil {
+		t.Fatalf("Couldn't update user: %v\n", err)
+	}
+	w = performConditional(r, t, http.MethodGet, "/", "If-None-Match", etag, nil)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Fatalf("Expected the changed page but instead got %d %q\n", w.Code, w.Header().Get("ETag"))
+	}
+}
+
+/**
+ * Function to test the versioned writes of the store
+ * case: failed, a user changed since it was read is not saved nor deleted
+ */
+func TestUserVersionConflict(t *testing.T) {
+	t.Parallel()
+	store := NewTestStore(t)
+	user := CreateTestUser(t, store, "versioned", "versioned#123", models.RoleMember)
+	stale := user
+
+	user.FullName = "First"
+	if err := store.Users.UpdateIfVersion(&user, "full_name"); err != nil || user.Version != stale.Version+1 {
+		t.Fatalf("Expected the update to increment the version but instead got %d, %v\n", user.Version, err)
+	}
+	stale.FullName = "Second"
+	if err := store.Users.UpdateIfVersion(&stale, "full_name"); err != storage.ErrConflict {
+		t.Fatalf("Expected to get %v but instead got %v\n", storage.ErrConflict, err)
+	}
+	if err := store.Users.DeleteIfVersion(stale.ID, stale.Version); err != storage.ErrConflict {
+		t.Fatalf("Expected to get %v but instead got %v\n", storage.ErrConflict, err)
+	}
+
+	// Failed logins and other security state don't change the version, a client's ETag stays valid
+	if err := store.Users.IncrementFailedLogins(&user, storage.Lockout{Threshold: 5, BaseDelay: time.Minute, MaxDelay: time.Hour}); err != nil {
+		t.Fatalf("Couldn't count the failed login: %v\n", err)
+	}
+	user.FailedLoginAttempts = 0
+	if err := store.Users.Update(&user, "failed_login_attempts"); err != nil {
+		t.Fatalf("Couldn't clear the failed logins: %v\n", err)
+	}
+	found, err := store.Users.FindByID(user.ID)
+	if err != nil || found.FullName != "First" || found.Version != stale.Version+1 {
+		t.Fatalf("Expected the first update to be kept with its version but instead got %+v, %v\n", found, err)
+	}
+	if err := store.Users.DeleteIfVersion(found.ID, found.Version); err != nil {
+		t.Fatalf("Couldn't delete user: %v\n", err)
+	}
+	if err := store.Users.UpdateIfVersion(found, "full_name"); err != storage.ErrNotFound {
+		t.Fatalf("Expected to get %v but instead got %v\n", storage.ErrNotFound, err)
+	}
+}
@@ -0,0 +1,148 @@
+package test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"ionixx/api/controllers"
+	"ionixx/api/signing"
+	"ionixx/api/storage"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// unreachableDatabase fails every health check of the database
+type unreachableDatabase struct{}
+
+func (unreachableDatabase) Ping(ctx context.Context) error {
+	return errors.New("connection refused")
+}
+
+func (unreachableDatabase) PendingMigrations(ctx context.Context) (int, error) {
+	return 0, errors.New("connection refused")
+}
+
+// stuckDatabase answers the ping but never answers the migrations query, like a locked table
+type stuckDatabase struct{}
+
+func (stuckDatabase) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (stuckDatabase) PendingMigrations(ctx context.Context) (int, error) {
+	<-ctx.Done()
+	return 0, ctx.Err()
+}
+
+/**
+ * Function to get the readiness of the store and the keys, the readiness route is registered on the router
+ */
+func getReadiness(r *gin.Engine, t *testing.T, store *storage.Store, keys *signing.KeySet) (int, controllers.HealthResponse) {
+	healthController := controllers.NewHealthController(store, keys)
+	r.GET("/readyz", healthController.Readiness)
+
+	w := PerformAuthorizedRequest(r, t, http.MethodGet, "/readyz", "", nil)
+	var readiness controllers.HealthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &readiness); err != nil {
+		t.Fatalf("Couldn't decode response: %v\n", err)
+	}
+	return w.Code, readiness
+}
+
+/**
+ * Function to test the liveness and readiness endpoints
+ * case: success
+ */
+func TestHealth(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	healthController := controllers.NewHealthController(store, TestKeys)
+	r.GET("/healthz", healthController.Liveness)
+
+	w := PerformAuthorizedRequest(r, t, http.MethodGet, "/healthz", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+
+	code, readiness := getReadiness(r, t, store, TestKeys)
+	if code != http.StatusOK || readiness.Status != "ok" {
+		t.Fatalf("Expected to be ready but instead got %d %+v\n", code, readiness)
+	}
+	for _, name := range []string{"database", "migrations", "signing_keys"} {
+		if readiness.Checks[name].Status != "ok" {
+			t.Fatalf("Expected the %s check to pass but instead got %+v\n", name, readiness.Checks[name])
+		}
+	}
+}
+
+/**
+ * Function to test the readiness endpoint
+ * case: failed, the database is unreachable
+ */
+func TestReadinessFailed(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	unreachable := *store
+	unreachable.Health = unreachableDatabase{}
+
+	code, readiness := getReadiness(r, t, &unreachable, TestKeys)
+	if code != http.StatusServiceUnavailable || readiness.Status != "fail" {
+		t.Fatalf("Expected to be unready but instead got %d %+v\n", code, readiness)
+	}
+	if check := readiness.Checks["database"]; check.Status != "fail" || check.Error == "" {
+		t.Fatalf("Expected the database check to fail but instead got %+v\n", check)
+	}
+	if readiness.Checks["signing_keys"].Status != "ok" {
+		t.Fatalf("Expected the signing keys check to pass but instead got %+v\n", readiness.Checks["signing_keys"])
+	}
+}
+
+/**
+ * Function to test the readiness endpoint
+ * case: failed, the migrations query is stuck and times out
+ */
+func TestReadinessStuckDatabase(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	stuck := *store
+	stuck.Health = stuckDatabase{}
+
+	start := time.Now()
+	code, readiness := getReadiness(r, t, &stuck, TestKeys)
+	if code != http.StatusServiceUnavailable || readiness.Checks["migrations"].Status != "fail" {
+		t.Fatalf("Expected the migrations check to fail but instead got %d %+v\n", code, readiness)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Expected the readiness to time out but instead it took %s\n", elapsed)
+	}
+}
+
+/**
+ * Function to test the readiness endpoint
+ * case: failed, the active signing key signs tokens its public key doesn't verify
+ */
+func TestReadinessBrokenSigningKey(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	otherPublicKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	key, err := signing.NewKey("broken", privateKey)
+	if err != nil {
+		t.Fatalf("Couldn't create key: %v\n", err)
+	}
+	key.PublicKey = otherPublicKey
+	keys, err := signing.NewKeySet(key.ID, key)
+	if err != nil {
+		t.Fatalf("Couldn't create key set: %v\n", err)
+	}
+
+	code, readiness := getReadiness(r, t, store, keys)
+	if code != http.StatusServiceUnavailable || readiness.Checks["signing_keys"].Status != "fail" {
+		t.Fatalf("Expected the signing keys check to fail but instead got %d %+v\n", code, readiness)
+	}
+}
@@ -0,0 +1,212 @@
+package test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"ionixx/api/controllers"
+	"ionixx/api/models"
+	"ionixx/api/signing"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+/**
+ * Function to write a private or public key as a <kid>.pem file
+ */
+func writeKeyFile(t *testing.T, dir string, kid string, key interface{}) {
+	var block *pem.Block
+	if !isPrivateKey(key) {
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			t.Fatalf("Couldn't marshal key: %v\n", err)
+		}
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	} else {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatalf("Couldn't marshal key: %v\n", err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("Couldn't write key: %v\n", err)
+	}
+}
+
+/**
+ * Function to check if the key is a private key
+ */
+func isPrivateKey(key interface{}) bool {
+	switch key.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+		return true
+	}
+	return false
+}
+
+/**
+ * Function to create test claims
+ */
+func testClaims() *models.JwtCustomClaims {
+	return &models.JwtCustomClaims{
+		UserID: 1,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(time.Minute).Unix(),
+		},
+	}
+}
+
+/**
+ * Function to test the jwks endpoint
+ * case: the kid of an issued token is published
+ */
+func TestJWKS(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	authController := controllers.NewAuthController(store, TestAuthConfig, TestKeys)
+	jwksController := controllers.NewJWKSController(TestKeys)
+	r.POST("/login", authController.Login)
+	r.GET("/.well-known/jwks.json", jwksController.GetJWKS)
+	SeedNewUser(r, t, store)
+
+	loginResponse := LoginSeededUser(r, t)
+
+	req, err := http.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	if err != nil {
+		t.Fatalf("Couldn't create request: %v\n", err)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	fmt.Println(w.Body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+
+	var jwks signing.JSONWebKeySet
+	if err := json.Unmarshal(w.Body.Bytes(), &jwks); err != nil {
+		t.Fatalf("Couldn't decode response: %v\n", err)
+	}
+
+	// The access token must name a published key
+	token, _, err := new(jwt.Parser).ParseUnverified(loginResponse.AccessToken, &models.JwtCustomClaims{})
+	if err != nil {
+		t.Fatalf("Couldn't parse token: %v\n", err)
+	}
+	for _, key := range jwks.Keys {
+		if key.KeyID == token.Header["kid"] && key.Algorithm == token.Method.Alg() {
+			return
+		}
+	}
+	t.Fatalf("Expected the jwks to contain the key %v\n", token.Header["kid"])
+}
+
+/**
+ * Function to test rotating the signing key
+ * case: tokens of the retiring key are still accepted
+ */
+func TestKeyRotation(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Couldn't generate key: %v\n", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Couldn't generate key: %v\n", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Couldn't generate key: %v\n", err)
+	}
+	writeKeyFile(t, dir, "rsa", rsaKey)
+	writeKeyFile(t, dir, "ec", ecKey)
+	writeKeyFile(t, dir, "ed", edKey)
+
+	// Three private keys require an explicit active key
+	if _, err := signing.LoadKeySet(dir, ""); err == nil {
+		t.Fatalf("Expected an error without an active key\n")
+	}
+
+	oldKeys, err := signing.LoadKeySet(dir, "rsa")
+	if err != nil {
+		t.Fatalf("Couldn't load keys: %v\n", err)
+	}
+	oldToken, err := oldKeys.Sign(testClaims())
+	if err != nil {
+		t.Fatalf("Couldn't sign token: %v\n", err)
+	}
+
+	// Rotate to the ec key and keep only the public part of the rsa key
+	writeKeyFile(t, dir, "rsa", &rsaKey.PublicKey)
+	newKeys, err := signing.LoadKeySet(dir, "ec")
+	if err != nil {
+		t.Fatalf("Couldn't load keys: %v\n", err)
+	}
+	if _, err := newKeys.Parse(oldToken, &models.JwtCustomClaims{}); err != nil {
+		t.Fatalf("Expected the retiring key to verify the token: %v\n", err)
+	}
+
+	newToken, err := newKeys.Sign(testClaims())
+	if err != nil {
+		t.Fatalf("Couldn't sign token: %v\n", err)
+	}
+	token, err := newKeys.Parse(newToken, &models.JwtCustomClaims{})
+	if err != nil {
+		t.Fatalf("Couldn't parse token: %v\n", err)
+	}
+	if token.Header["kid"] != "ec" || token.Method.Alg() != "ES256" {
+		t.Fatalf("Expected the token to be signed by the ec key, got %v %v\n", token.Header["kid"], token.Method.Alg())
+	}
+
+	// A public key can not become the active key
+	if _, err := signing.LoadKeySet(dir, "rsa"); err == nil {
+		t.Fatalf("Expected an error for an active key without private key\n")
+	}
+
+	types := []string{}
+	for _, key := range newKeys.JWKS().Keys {
+		types = append(types, key.KeyID+":"+key.KeyType+":"+key.Algorithm)
+	}
+	if strings.Join(types, ",") != "ec:EC:ES256,ed:OKP:EdDSA,rsa:RSA:RS256" {
+		t.Fatalf("Unexpected jwks keys %v\n", types)
+	}
+}
+
+/**
+ * Function to test verifying a token of an unknown key
+ * case: the token is rejected
+ */
+func TestUnknownSigningKey(t *testing.T) {
+	t.Parallel()
+	otherKeys, err := signing.GenerateKeySet()
+	if err != nil {
+		t.Fatalf("Couldn't generate keys: %v\n", err)
+	}
+	token, err := otherKeys.Sign(testClaims())
+	if err != nil {
+		t.Fatalf("Couldn't sign token: %v\n", err)
+	}
+
+	keys, err := signing.GenerateKeySet()
+	if err != nil {
+		t.Fatalf("Couldn't generate keys: %v\n", err)
+	}
+	if _, err := keys.Parse(token, &models.JwtCustomClaims{}); err == nil {
+		t.Fatalf("Expected the token of another key to be rejected\n")
+	}
+}
@@ -0,0 +1,246 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"ionixx/api/controllers"
+	"ionixx/api/limiter"
+	"ionixx/api/middlewares"
+	"ionixx/api/models"
+	"ionixx/api/response"
+	"ionixx/api/storage"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+/**
+ * Function to setup the login and unlock routes
+ */
+func setupLockoutRoutes(r *gin.Engine, store *storage.Store) {
+	authController := controllers.NewAuthController(store, TestAuthConfig, TestKeys)
+	userController := controllers.NewUserController(store, TestAuthConfig)
+	r.POST("/login", authController.Login)
+	r.POST("/:id/unlock", middlewares.AuthMiddleware(store, TestKeys), middlewares.RequireRole(models.RoleAdmin), userController.UnlockUser)
+}
+
+/**
+ * Function to attempt a login and return the response
+ */
+func attemptLogin(r *gin.Engine, t *testing.T, userName string, password string) int {
+	data, _ := json.Marshal(controllers.LoginRequest{UserName: userName, Password: password})
+	w := PerformAuthorizedRequest(r, t, http.MethodPost, "/login", "", data)
+	return w.Code
+}
+
+/**
+ * Function to test the account lockout
+ * case: the account is locked after repeated failures until an admin unlocks it
+ */
+func TestAccountLockout(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	setupLockoutRoutes(r, store)
+	CreateTestUser(t, store, "admin", "admin#123", models.RoleAdmin)
+	user := CreateTestUser(t, store, "victim", "victim#123", models.RoleMember)
+	admin := LoginUser(r, t, "admin", "admin#123")
+
+	for i := 0; i < 5; i++ {
+		if code := attemptLogin(r, t, "victim", "guess#123"); code != http.StatusBadRequest {
+			t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusBadRequest, code)
+		}
+	}
+
+	// Even the right password is rejected while the account is locked
+	data, _ := json.Marshal(controllers.LoginRequest{UserName: "victim", Password: "victim#123"})
+	w := PerformAuthorizedRequest(r, t, http.MethodPost, "/login", "", data)
+	fmt.Println(w.Body)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusTooManyRequests, w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Fatalf("Expected a Retry-After header\n")
+	}
+
+	// The lockout is visible on the user record
+	locked, _ := store.Users.FindByID(user.ID)
+	if locked.FailedLoginAttempts != 5 || locked.LockedUntil == nil {
+		t.Fatalf("Expected the user to be locked, got %d attempts and locked until %v\n", locked.FailedLoginAttempts, locked.LockedUntil)
+	}
+
+	w = PerformAuthorizedRequest(r, t, http.MethodPost, fmt.Sprintf("/%d/unlock", user.ID), admin.AccessToken, nil)
+	fmt.Println(w.Body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+
+	LoginUser(r, t, "victim", "victim#123")
+}
+
+/**
+ * Function to test the backoff of an ip
+ * case: an ip guessing many accounts has to back off
+ */
+func TestIPBackoff(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	setupLockoutRoutes(r, store)
+
+	for i := 0; i < 20; i++ {
+		if code := attemptLogin(r, t, fmt.Sprintf("unknown%d", i), "guess#123"); code != http.StatusBadRequest {
+			t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusBadRequest, code)
+		}
+	}
+
+	if code := attemptLogin(r, t, "unknown", "guess#123"); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusTooManyRequests, code)
+	}
+}
+
+/**
+ * Function to test the lock set by the failed logins in the store
+ * case: concurrent failures are all counted and lock the account for the delay of the count they reach
+ */
+func TestFailedLoginsLockedUntil(t *testing.T) {
+	t.Parallel()
+	_, store := SetupTestServer(t)
+	user := CreateTestUser(t, store, "hammered", "hammered#123", models.RoleMember)
+	lockout := storage.Lockout{Threshold: 5, BaseDelay: time.Minute, MaxDelay: time.Hour}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			failed := user
+			if err := store.Users.IncrementFailedLogins(&failed, lockout); err != nil {
+				t.Errorf("Couldn't count the failed login: %v\n", err)
+			}
+		}()
+	}
+	wg.Wait()
+	stored, _ := store.Users.FindByID(user.ID)
+	if stored.FailedLoginAttempts != 4 || stored.LockedUntil != nil {
+		t.Fatalf("Expected 4 failures and no lock but instead got %d and %v\n", stored.FailedLoginAttempts, stored.LockedUntil)
+	}
+
+	for _, lock := range []struct {
+		failures int
+		delay    time.Duration
+	}{{5, time.Minute}, {6, 2 * time.Minute}, {7, 4 * time.Minute}, {12, time.Hour}} {
+		failures, delay := lock.failures, lock.delay
+		for stored.FailedLoginAttempts < failures {
+			start := time.Now()
+			if err := store.Users.IncrementFailedLogins(stored, lockout); err != nil {
+				t.Fatalf("Couldn't count the failed login: %v\n", err)
+			}
+			stored, _ = store.Users.FindByID(user.ID)
+			if stored.FailedLoginAttempts == failures {
+				if stored.LockedUntil == nil || stored.LockedUntil.Before(start.Add(delay)) || stored.LockedUntil.After(time.Now().Add(delay)) {
+					t.Fatalf("Expected %d failures to lock for %s but instead got %v\n", failures, delay, stored.LockedUntil)
+				}
+			}
+		}
+	}
+}
+
+/**
+ * Function to test the lockout of user names without an account
+ * case: they are locked like accounts, so the lockout doesn't reveal which accounts exist
+ */
+func TestUnknownUserLockout(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	setupLockoutRoutes(r, store)
+	CreateTestUser(t, store, "known", "known#123", models.RoleMember)
+
+	for _, userName := range []string{"known", "ghost"} {
+		for i := 0; i < 5; i++ {
+			if code := attemptLogin(r, t, userName, "guess#123"); code != http.StatusBadRequest {
+				t.Fatalf("%s: expected to get status %d but instead got %d\n", userName, http.StatusBadRequest, code)
+			}
+		}
+		data, _ := json.Marshal(controllers.LoginRequest{UserName: userName, Password: "guess#123"})
+		w := PerformAuthorizedRequest(r, t, http.MethodPost, "/login", "", data)
+		decodeProblem(t, w, http.StatusTooManyRequests, response.CodeTooManyAttempts)
+		if w.Header().Get("Retry-After") == "" {
+			t.Fatalf("%s: expected a Retry-After header\n", userName)
+		}
+	}
+}
+
+/**
+ * Function to test the backoff of an ip is cleared by a successful login
+ * case: users behind a shared ip aren't held back by the typos before
+ */
+func TestIPBackoffReset(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	setupLockoutRoutes(r, store)
+	CreateTestUser(t, store, "shared", "shared#123", models.RoleMember)
+
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 19; i++ {
+			if code := attemptLogin(r, t, fmt.Sprintf("typo%d-%d", round, i), "guess#123"); code != http.StatusBadRequest {
+				t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusBadRequest, code)
+			}
+		}
+		LoginUser(r, t, "shared", "shared#123")
+	}
+}
+
+/**
+ * Function to test the backoff of an ip can't be escaped with a forged X-Forwarded-For header
+ * case: failed logins are counted for the address of the connection when it is not a trusted proxy
+ */
+func TestIPBackoffForwardedFor(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	setupLockoutRoutes(r, store)
+
+	code := 0
+	for i := 0; i <= 20; i++ {
+		data, _ := json.Marshal(controllers.LoginRequest{UserName: fmt.Sprintf("unknown%d", i), Password: "guess#123"})
+		req, err := http.NewRequest(http.MethodPost, "/login", bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Couldn't create request: %v\n", err)
+		}
+		req.RemoteAddr = "203.0.113.7:40000"
+		req.Header.Set("Content-Type", "application/json")
+		// A new forged client ip on every attempt
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("198.51.100.%d", i))
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		code = w.Code
+	}
+
+	if code != http.StatusTooManyRequests {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusTooManyRequests, code)
+	}
+}
+
+/**
+ * Function to test the exponential backoff delay
+ * case: the delay doubles after the threshold up to the maximum
+ */
+func TestBackoffDelay(t *testing.T) {
+	t.Parallel()
+	cases := map[int]time.Duration{
+		4:  0,
+		5:  time.Minute,
+		6:  2 * time.Minute,
+		7:  4 * time.Minute,
+		20: time.Hour,
+	}
+	for failures, expected := range cases {
+		if delay := limiter.Delay(failures, 5, time.Minute, time.Hour); delay != expected {
+			t.Fatalf("Expected a delay of %v after %d failures but got %v\n", expected, failures, delay)
+		}
+	}
+}
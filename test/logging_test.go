@@ -0,0 +1,119 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"ionixx/api/config"
+	"ionixx/api/controllers"
+	"ionixx/api/logging"
+	"ionixx/api/response"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+/**
+ * Function to test the request id of the responses
+ * case: success, a valid client id is kept and an invalid one is replaced
+ */
+func TestRequestID(t *testing.T) {
+	t.Parallel()
+	r, _ := SetupTestServer(t)
+	r.GET("/missing", func(c *gin.Context) {
+		response.ErrorJSON(c, http.StatusNotFound, response.CodeNotFound, "Not found")
+	})
+
+	for _, test := range []struct {
+		clientID string
+		keep     bool
+	}{
+		{"", false},
+		{"client-id.42", true},
+		{"forged\nline", false},
+		{strings.Repeat("a", 129), false},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, "/missing", nil)
+		req.Header.Set(logging.RequestIDHeader, test.clientID)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		requestID := w.Header().Get(logging.RequestIDHeader)
+		if requestID == "" || (requestID == test.clientID) != test.keep {
+			t.Fatalf("Expected the request id of %q to be kept: %v, but instead got %q\n", test.clientID, test.keep, requestID)
+		}
+		var body response.Response
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.RequestID != requestID {
+			t.Fatalf("Expected the response to have the request id %q but instead got %s\n", requestID, w.Body)
+		}
+	}
+}
+
+/**
+ * Function to test the request log
+ * case: success, every line of the request has its id and the passwords are redacted
+ */
+func TestRequestLog(t *testing.T) {
+	t.Parallel()
+	_, store := SetupTestServer(t)
+	var logs bytes.Buffer
+	r := gin.New()
+	r.Use(logging.Middleware(logging.New(config.LogConfig{Level: "debug", Format: "json"}, &logs)))
+	userController := controllers.NewUserController(store, TestAuthConfig)
+	r.POST("/user", userController.CreateUser)
+
+	data, err := json.Marshal(controllers.CreateUserRequest{
+		UserName:    "logged",
+		Password:    "super#secret",
+		FullName:    "Logged User",
+		Dob:         time.Date(1990, time.January, 1, 0, 0, 0, 0, time.UTC),
+		LinkedinURL: "https://linkedin.com/in/logged",
+	})
+	if err != nil {
+		t.Fatalf("Couldn't create request: %v\n", err)
+	}
+	w := PerformAuthorizedRequest(r, t, http.MethodPost, "/user", "", data)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+
+	// Neither the password nor its hash are logged, not even in the SQL
+	if strings.Contains(logs.String(), "super#secret") || strings.Contains(logs.String(), "$2a$") {
+		t.Fatalf("Expected the password to be redacted but instead got\n%s", logs.String())
+	}
+	requestID := w.Header().Get(logging.RequestIDHeader)
+	var request map[string]interface{}
+	statements := 0
+	scanner := bufio.NewScanner(&logs)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("Expected a json log line but instead got %s\n", scanner.Text())
+		}
+		if line["request_id"] != requestID {
+			t.Fatalf("Expected the line to have the request id %s but instead got %s\n", requestID, scanner.Text())
+		}
+		switch line["msg"] {
+		case "request":
+			request = line
+		case "sql":
+			statements++
+		}
+	}
+
+	if request == nil || request["route"] != "/user" || request["status"] != float64(http.StatusOK) {
+		t.Fatalf("Expected a request line with the route and status but instead got %v\n", request)
+	}
+	// The memory store runs no SQL
+	if pool, _ := store.ConnectionPool(); pool != nil && statements == 0 {
+		t.Fatalf("Expected the SQL statements of the request to be logged\n")
+	}
+	body, _ := request["body"].(map[string]interface{})
+	if body["password"] != "[REDACTED]" || body["user_name"] != "logged" {
+		t.Fatalf("Expected the body to be logged with the password redacted but instead got %v\n", request["body"])
+	}
+}
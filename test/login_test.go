@@ -14,18 +14,19 @@ import (
  * case: login with valid credentials
  */
 func TestLoginSuccess(t *testing.T) {
+	t.Parallel()
 
 	// Setup the test server
-	r := SetupTestServer()
+	r, store := SetupTestServer(t)
 
 	// Create a new controller
-	authController := controllers.AuthController{}
+	authController := controllers.NewAuthController(store, TestAuthConfig, TestKeys)
 
 	// Setup the endpoint
 	r.POST("/login", authController.Login)
 
 	// Seed a new user
-	SeedNewUser(r, t)
+	SeedNewUser(r, t, store)
 
 	// Get the payload
 	data, err := GetUserPayload()
@@ -58,16 +59,17 @@ func TestLoginSuccess(t *testing.T) {
  * case: login with invalid credentials
  */
 func TestLoginFailed(t *testing.T) {
+	t.Parallel()
 
 	// Setup the test server
-	r := SetupTestServer()
+	r, store := SetupTestServer(t)
 	// Create a new controller
-	authController := controllers.AuthController{}
+	authController := controllers.NewAuthController(store, TestAuthConfig, TestKeys)
 	// Setup the endpoint
 	r.POST("/login", authController.Login)
 
 	// Seed a new user
-	SeedNewUser(r, t)
+	SeedNewUser(r, t, store)
 
 	// Get the payload
 	data, err := GetInvalidUserPayload()
@@ -0,0 +1,148 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"ionixx/api/controllers"
+	"ionixx/api/middlewares"
+	"ionixx/api/storage"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+/**
+ * Function to setup the logout and revoke endpoints
+ */
+func setupLogoutRoutes(r *gin.Engine, store *storage.Store) {
+	authController := controllers.NewAuthController(store, TestAuthConfig, TestKeys)
+	sessionController := controllers.NewSessionController(store)
+	r.POST("/login", authController.Login)
+	r.POST("/refresh", authController.Refresh)
+	r.POST("/revoke", authController.Revoke)
+	r.POST("/logout", middlewares.AuthMiddleware(store, TestKeys), authController.Logout)
+	r.POST("/logout/all", middlewares.AuthMiddleware(store, TestKeys), authController.LogoutAll)
+	r.GET("/sessions", middlewares.AuthMiddleware(store, TestKeys), sessionController.GetSessions)
+}
+
+/**
+ * Function to test the logout endpoint
+ * case: only the current session is logged out
+ */
+func TestLogout(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	setupLogoutRoutes(r, store)
+	SeedNewUser(r, t, store)
+
+	laptop := LoginSeededUser(r, t)
+	phone := LoginSeededUser(r, t)
+
+	w := PerformAuthorizedRequest(r, t, http.MethodPost, "/logout", laptop.AccessToken, nil)
+	fmt.Println(w.Body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+
+	w = PerformAuthorizedRequest(r, t, http.MethodGet, "/sessions", laptop.AccessToken, nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusUnauthorized, w.Code)
+	}
+
+	w = performRefresh(r, t, laptop.RefreshToken)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusUnauthorized, w.Code)
+	}
+
+	w = PerformAuthorizedRequest(r, t, http.MethodGet, "/sessions", phone.AccessToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+}
+
+/**
+ * Function to test the logout everywhere endpoint
+ * case: every session is logged out
+ */
+func TestLogoutAll(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	setupLogoutRoutes(r, store)
+	SeedNewUser(r, t, store)
+
+	laptop := LoginSeededUser(r, t)
+	phone := LoginSeededUser(r, t)
+
+	w := PerformAuthorizedRequest(r, t, http.MethodPost, "/logout/all", laptop.AccessToken, nil)
+	fmt.Println(w.Body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+
+	for _, token := range []string{laptop.AccessToken, phone.AccessToken} {
+		w = PerformAuthorizedRequest(r, t, http.MethodGet, "/sessions", token, nil)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusUnauthorized, w.Code)
+		}
+	}
+}
+
+/**
+ * Function to test the revoke endpoint with form and json bodies
+ * case: revoked access and refresh tokens are rejected
+ */
+func TestRevokeTokens(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	setupLogoutRoutes(r, store)
+	SeedNewUser(r, t, store)
+
+	laptop := LoginSeededUser(r, t)
+	phone := LoginSeededUser(r, t)
+
+	// Revoke the access token of the laptop with a form body
+	form := url.Values{"token": {laptop.AccessToken}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequest(http.MethodPost, "/revoke", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatalf("Couldn't create request: %v\n", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	fmt.Println(w.Body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+
+	w = PerformAuthorizedRequest(r, t, http.MethodGet, "/sessions", laptop.AccessToken, nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusUnauthorized, w.Code)
+	}
+
+	// Revoke the refresh token of the phone with a json body
+	data, err := json.Marshal(controllers.RevokeRequest{Token: phone.RefreshToken})
+	if err != nil {
+		t.Fatalf("Couldn't create request: %v\n", err)
+	}
+	w = PerformAuthorizedRequest(r, t, http.MethodPost, "/revoke", "", data)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+
+	// Revoking the refresh token also revokes the access token of its session
+	w = PerformAuthorizedRequest(r, t, http.MethodGet, "/sessions", phone.AccessToken, nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusUnauthorized, w.Code)
+	}
+
+	// Unknown tokens are not an error
+	data, _ = json.Marshal(controllers.RevokeRequest{Token: "unknown"})
+	w = PerformAuthorizedRequest(r, t, http.MethodPost, "/revoke", "", data)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+}
@@ -0,0 +1,106 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"ionixx/api/controllers"
+	"ionixx/api/middlewares"
+	"ionixx/api/models"
+	"ionixx/api/notify"
+	"ionixx/api/storage"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+/**
+ * Function to setup the login route and the me routes as the server does
+ */
+func setupMeRoutes(r *gin.Engine, store *storage.Store) {
+	authController := controllers.NewAuthController(store, TestAuthConfig, TestKeys)
+	userController := controllers.NewUserController(store, TestAuthConfig)
+	passwordController := controllers.NewPasswordController(store, TestAuthConfig, &notify.MemoryNotifier{})
+	sessionController := controllers.NewSessionController(store)
+	r.POST("/login", authController.Login)
+	me := r.Group("/me", middlewares.AuthMiddleware(store, TestKeys))
+	me.GET("", userController.GetMe)
+	me.PUT("", userController.UpdateMe)
+	me.DELETE("", userController.DeleteMe)
+	me.PUT("/password", passwordController.ChangePassword)
+	me.GET("/sessions", sessionController.GetSessions)
+	me.DELETE("/sessions/:id", sessionController.RevokeSession)
+}
+
+/**
+ * Function to test the me routes
+ * case: success, the routes act on the logged in user without its id
+ */
+func TestMe(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	setupMeRoutes(r, store)
+	CreateTestUser(t, store, "other", "other#123", models.RoleMember)
+	user := CreateTestUser(t, store, "myself", "myself#123", models.RoleMember)
+	tokens := LoginUser(r, t, "myself", "myself#123")
+
+	w := PerformAuthorizedRequest(r, t, http.MethodGet, "/me", tokens.AccessToken, nil)
+	fmt.Println(w.Body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+	var me models.User
+	DecodeResponseData(t, w, &me)
+	if me.ID != user.ID || me.UserName != "myself" {
+		t.Fatalf("Expected to get the logged in user but instead got %+v\n", me)
+	}
+
+	data, _ := json.Marshal(controllers.UpdateUserRequest{FullName: "Me Myself"})
+	w = PerformAuthorizedRequest(r, t, http.MethodPut, "/me", tokens.AccessToken, data)
+	DecodeResponseData(t, w, &me)
+	if w.Code != http.StatusOK || me.FullName != "Me Myself" {
+		t.Fatalf("Expected the full name to be updated but instead got %d %+v\n", w.Code, me)
+	}
+
+	w = PerformAuthorizedRequest(r, t, http.MethodGet, "/me/sessions", tokens.AccessToken, nil)
+	var sessions []controllers.SessionResponse
+	DecodeResponseData(t, w, &sessions)
+	if w.Code != http.StatusOK || len(sessions) != 1 || !sessions[0].Current {
+		t.Fatalf("Expected the current session but instead got %d %+v\n", w.Code, sessions)
+	}
+
+	data, _ = json.Marshal(controllers.ChangePasswordRequest{CurrentPassword: "myself#123", NewPassword: "new#123"})
+	w = PerformAuthorizedRequest(r, t, http.MethodPut, "/me/password", tokens.AccessToken, data)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+	tokens = LoginUser(r, t, "myself", "new#123")
+
+	// Deleting the user logs out its sessions
+	w = PerformAuthorizedRequest(r, t, http.MethodDelete, "/me", tokens.AccessToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+	w = PerformAuthorizedRequest(r, t, http.MethodGet, "/me", tokens.AccessToken, nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusUnauthorized, w.Code)
+	}
+	if _, err := store.Users.FindByUserName("other"); err != nil {
+		t.Fatalf("Expected the other user to be kept but instead got %v\n", err)
+	}
+}
+
+/**
+ * Function to test the me routes without a token
+ * case: failed, the caller is unauthorized
+ */
+func TestMeUnauthorized(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	setupMeRoutes(r, store)
+
+	w := PerformAuthorizedRequest(r, t, http.MethodGet, "/me", "", nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusUnauthorized, w.Code)
+	}
+}
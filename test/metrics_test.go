@@ -0,0 +1,76 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"ionixx/api/controllers"
+	"ionixx/api/metrics"
+	"ionixx/api/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+/**
+ * Function to test the metrics endpoint
+ * case: success, requests are labeled by route template and logins by outcome
+ */
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	r.Use(metrics.Middleware())
+	authController := controllers.NewAuthController(store, TestAuthConfig, TestKeys)
+	r.POST("/login", authController.Login)
+	r.GET("/metrics", metrics.Handler())
+	CreateTestUser(t, store, "measured", "measured#123", models.RoleMember)
+
+	LoginUser(r, t, "measured", "measured#123")
+	data, _ := json.Marshal(controllers.LoginRequest{UserName: "measured", Password: "wrong#123"})
+	req, _ := http.NewRequest(http.MethodPost, "/login", bytes.NewReader(data))
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	w := PerformAuthorizedRequest(r, t, http.MethodGet, "/metrics", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+	body := w.Body.String()
+	for _, metric := range []string{
+		`ionixx_http_requests_total{method="POST",route="/login",status="200"}`,
+		`ionixx_http_request_duration_seconds_count{method="POST",route="/login"}`,
+		`ionixx_auth_login_attempts_total{outcome="success"}`,
+		`ionixx_auth_login_attempts_total{outcome="wrong_password"}`,
+		`ionixx_auth_bcrypt_duration_seconds_count{operation="compare"}`,
+	} {
+		if !strings.Contains(body, metric) {
+			t.Fatalf("Expected the metrics to contain %s\n", metric)
+		}
+	}
+}
+
+/**
+ * Function to test the connection pool statistics
+ * case: the pool of a server set up again replaces the one registered before with the same name
+ */
+func TestRegisterDBStatsTwice(t *testing.T) {
+	t.Parallel()
+	r, _ := SetupTestServer(t)
+	r.GET("/metrics", metrics.Handler())
+
+	for _, maxOpen := range []int{3, 7} {
+		pool, err := openTestStore(t, "sqlite", "file::memory:").ConnectionPool()
+		if err != nil {
+			t.Fatalf("Couldn't get the connection pool: %v\n", err)
+		}
+		pool.SetMaxOpenConns(maxOpen)
+		if err := metrics.RegisterDBStats(pool, "registered_twice"); err != nil {
+			t.Fatalf("Expected to register the connection pool but instead got %v\n", err)
+		}
+	}
+
+	w := PerformAuthorizedRequest(r, t, http.MethodGet, "/metrics", "", nil)
+	metric := `go_sql_max_open_connections{db_name="registered_twice"} 7`
+	if !strings.Contains(w.Body.String(), metric) {
+		t.Fatalf("Expected the metrics to contain %s\n", metric)
+	}
+}
@@ -0,0 +1,192 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"ionixx/api/controllers"
+	"ionixx/api/middlewares"
+	"ionixx/api/models"
+	"ionixx/api/response"
+	"ionixx/api/storage"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pquerna/otp/totp"
+)
+
+/**
+ * Function to setup the mfa routes
+ */
+func setupMFARoutes(r *gin.Engine, store *storage.Store) {
+	authController := controllers.NewAuthController(store, TestAuthConfig, TestKeys)
+	sessionController := controllers.NewSessionController(store)
+	mfaController := controllers.NewMFAController(store, TestAuthConfig, TestKeys)
+	r.POST("/login", authController.Login)
+	r.POST("/mfa/verify", mfaController.Verify)
+	r.POST("/mfa/enroll", middlewares.AuthMiddleware(store, TestKeys), mfaController.Enroll)
+	r.POST("/mfa/confirm", middlewares.AuthMiddleware(store, TestKeys), mfaController.Confirm)
+	r.GET("/sessions", middlewares.AuthMiddleware(store, TestKeys), sessionController.GetSessions)
+}
+
+/**
+ * Function to enroll and confirm mfa for the logged in user
+ */
+func enableMFA(r *gin.Engine, t *testing.T, accessToken string) (string, []string) {
+	w := PerformAuthorizedRequest(r, t, http.MethodPost, "/mfa/enroll", accessToken, nil)
+	fmt.Println(w.Body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+	var enrollment controllers.MFAEnrollResponse
+	DecodeResponseData(t, w, &enrollment)
+
+	// Confirm with the code of the previous step, each step is accepted once and the current one is left for the login
+	code, err := totp.GenerateCode(enrollment.Secret, time.Now().Add(-30*time.Second))
+	if err != nil {
+		t.Fatalf("Couldn't generate code: %v\n", err)
+	}
+	data, _ := json.Marshal(controllers.MFACodeRequest{Code: code})
+	w = PerformAuthorizedRequest(r, t, http.MethodPost, "/mfa/confirm", accessToken, data)
+	fmt.Println(w.Body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+	var recovery controllers.MFARecoveryCodesResponse
+	DecodeResponseData(t, w, &recovery)
+	return enrollment.Secret, recovery.RecoveryCodes
+}
+
+/**
+ * Function to login and return the mfa challenge
+ */
+func loginWithMFA(r *gin.Engine, t *testing.T, userName string, password string) controllers.MFAChallengeResponse {
+	data, _ := json.Marshal(controllers.LoginRequest{UserName: userName, Password: password})
+	w := PerformAuthorizedRequest(r, t, http.MethodPost, "/login", "", data)
+	fmt.Println(w.Body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+	var challenge controllers.MFAChallengeResponse
+	DecodeResponseData(t, w, &challenge)
+	if !challenge.MFARequired || challenge.MFAToken == "" {
+		t.Fatalf("Expected login to return an mfa challenge\n")
+	}
+	return challenge
+}
+
+/**
+ * Function to test login with totp mfa
+ * case: tokens are only issued after the challenge is verified
+ */
+func TestMFALogin(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	setupMFARoutes(r, store)
+	CreateTestUser(t, store, "secure", "secure#123", models.RoleMember)
+	session := LoginUser(r, t, "secure", "secure#123")
+	secret, _ := enableMFA(r, t, session.AccessToken)
+
+	challenge := loginWithMFA(r, t, "secure", "secure#123")
+
+	// The challenge token is not an access token
+	w := PerformAuthorizedRequest(r, t, http.MethodGet, "/sessions", challenge.MFAToken, nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusUnauthorized, w.Code)
+	}
+
+	data, _ := json.Marshal(controllers.MFAVerifyRequest{MFAToken: challenge.MFAToken, Code: "000000"})
+	w = PerformAuthorizedRequest(r, t, http.MethodPost, "/mfa/verify", "", data)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusUnauthorized, w.Code)
+	}
+
+	code, _ := totp.GenerateCode(secret, time.Now())
+	data, _ = json.Marshal(controllers.MFAVerifyRequest{MFAToken: challenge.MFAToken, Code: code})
+	w = PerformAuthorizedRequest(r, t, http.MethodPost, "/mfa/verify", "", data)
+	fmt.Println(w.Body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+
+	var loginResponse controllers.LoginResponse
+	DecodeResponseData(t, w, &loginResponse)
+	w = PerformAuthorizedRequest(r, t, http.MethodGet, "/sessions", loginResponse.AccessToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+}
+
+/**
+ * Function to test login with a recovery code
+ * case: each recovery code can only be used once
+ */
+func TestMFARecoveryCode(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	setupMFARoutes(r, store)
+	CreateTestUser(t, store, "secure", "secure#123", models.RoleMember)
+	session := LoginUser(r, t, "secure", "secure#123")
+	_, recoveryCodes := enableMFA(r, t, session.AccessToken)
+	if len(recoveryCodes) == 0 {
+		t.Fatalf("Expected recovery codes\n")
+	}
+
+	challenge := loginWithMFA(r, t, "secure", "secure#123")
+	data, _ := json.Marshal(controllers.MFAVerifyRequest{MFAToken: challenge.MFAToken, RecoveryCode: recoveryCodes[0]})
+	w := PerformAuthorizedRequest(r, t, http.MethodPost, "/mfa/verify", "", data)
+	fmt.Println(w.Body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+
+	w = PerformAuthorizedRequest(r, t, http.MethodPost, "/mfa/verify", "", data)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusUnauthorized, w.Code)
+	}
+}
+
+/**
+ * Function to test the mfa challenge and the totp code can't be replayed
+ * case: failed, a used challenge token or a used code gets no session
+ */
+func TestMFAReplay(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	setupMFARoutes(r, store)
+	CreateTestUser(t, store, "secure", "secure#123", models.RoleMember)
+	session := LoginUser(r, t, "secure", "secure#123")
+	secret, _ := enableMFA(r, t, session.AccessToken)
+
+	challenge := loginWithMFA(r, t, "secure", "secure#123")
+	code, _ := totp.GenerateCode(secret, time.Now())
+	data, _ := json.Marshal(controllers.MFAVerifyRequest{MFAToken: challenge.MFAToken, Code: code})
+	w := PerformAuthorizedRequest(r, t, http.MethodPost, "/mfa/verify", "", data)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+
+	// The same challenge and code again
+	w = PerformAuthorizedRequest(r, t, http.MethodPost, "/mfa/verify", "", data)
+	decodeProblem(t, w, http.StatusUnauthorized, response.CodeInvalidToken)
+
+	// The used code with a new challenge
+	next := loginWithMFA(r, t, "secure", "secure#123")
+	data, _ = json.Marshal(controllers.MFAVerifyRequest{MFAToken: next.MFAToken, Code: code})
+	w = PerformAuthorizedRequest(r, t, http.MethodPost, "/mfa/verify", "", data)
+	decodeProblem(t, w, http.StatusUnauthorized, response.CodeInvalidMFACode)
+
+	// The used challenge with the code of the next step
+	nextCode, _ := totp.GenerateCode(secret, time.Now().Add(30*time.Second))
+	data, _ = json.Marshal(controllers.MFAVerifyRequest{MFAToken: challenge.MFAToken, Code: nextCode})
+	w = PerformAuthorizedRequest(r, t, http.MethodPost, "/mfa/verify", "", data)
+	decodeProblem(t, w, http.StatusUnauthorized, response.CodeInvalidToken)
+
+	// The code is not used up by the rejected challenge
+	data, _ = json.Marshal(controllers.MFAVerifyRequest{MFAToken: next.MFAToken, Code: nextCode})
+	w = PerformAuthorizedRequest(r, t, http.MethodPost, "/mfa/verify", "", data)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+}
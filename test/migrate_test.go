@@ -0,0 +1,60 @@
+package test
+
+import (
+	"ionixx/api/logging"
+	"ionixx/api/models"
+	"ionixx/api/storage"
+	"testing"
+)
+
+/**
+ * Function to test the migrations are applied and rolled back in order
+ * case: success
+ */
+func TestMigrations(t *testing.T) {
+	t.Parallel()
+	db, err := storage.OpenDB("sqlite", "file::memory:", logging.Discard)
+	if err != nil {
+		t.Fatalf("Couldn't open database: %v\n", err)
+	}
+
+	applied, err := storage.MigrateUp(db)
+	if err != nil || len(applied) == 0 {
+		t.Fatalf("Expected to apply the migrations but instead got %d, %v\n", len(applied), err)
+	}
+	if !db.Migrator().HasTable(&models.User{}) {
+		t.Fatalf("Expected the users table to be created\n")
+	}
+
+	// Applied migrations are not applied again
+	if applied, err := storage.MigrateUp(db); err != nil || len(applied) != 0 {
+		t.Fatalf("Expected no pending migrations but instead got %d, %v\n", len(applied), err)
+	}
+
+	// Only the latest migration is rolled back
+	rolledBack, err := storage.MigrateDown(db, 1)
+	if err != nil || len(rolledBack) != 1 || rolledBack[0].Version != applied[len(applied)-1].Version {
+		t.Fatalf("Expected to roll back the latest migration but instead got %v, %v\n", rolledBack, err)
+	}
+	statuses, err := storage.MigrationStatuses(db)
+	if err != nil {
+		t.Fatalf("Couldn't get migration statuses: %v\n", err)
+	}
+	for i, status := range statuses {
+		if pending := i == len(statuses)-1; (status.AppliedAt == nil) != pending {
+			t.Fatalf("Expected only the latest migration to be pending but instead got %+v\n", statuses)
+		}
+	}
+
+	// Rolling back every migration drops the tables
+	if _, err := storage.MigrateDown(db, len(statuses)); err != nil {
+		t.Fatalf("Couldn't roll back migrations: %v\n", err)
+	}
+	if db.Migrator().HasTable(&models.User{}) {
+		t.Fatalf("Expected the users table to be dropped\n")
+	}
+
+	if applied, err := storage.MigrateUp(db); err != nil || len(applied) != len(statuses) {
+		t.Fatalf("Expected to apply every migration again but instead got %d, %v\n", len(applied), err)
+	}
+}
@@ -0,0 +1,173 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"ionixx/api/controllers"
+	"ionixx/api/models"
+	"ionixx/api/response"
+	"ionixx/api/storage"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+/**
+ * Function to setup the user list route and seed users with a date of birth
+ */
+func setupPaginationRoutes(r *gin.Engine, t *testing.T, store *storage.Store) {
+	userController := controllers.NewUserController(store, TestAuthConfig)
+	r.GET("/", userController.GetAllUsers)
+
+	for i, name := range []string{"alice", "bob", "carol", "dave", "erin"} {
+		user := CreateTestUser(t, store, name, name+"#123", models.RoleMember)
+		// Dave has no date of birth
+		if name != "dave" {
+			dob := time.Date(1990+i, time.January, 1, 0, 0, 0, 0, time.UTC)
+			user.Dob = &dob
+			store.Users.Update(&user, "dob")
+		}
+	}
+}
+
+/**
+ * Function to get a page of users
+ */
+func listUsers(r *gin.Engine, t *testing.T, query url.Values) ([]models.User, response.PageMeta, int) {
+	req, err := http.NewRequest(http.MethodGet, "/?"+query.Encode(), nil)
+	if err != nil {
+		t.Fatalf("Couldn't create request: %v\n", err)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	fmt.Println(w.Body)
+
+	var body struct {
+		Data []models.User     `json:"data"`
+		Meta response.PageMeta `json:"meta"`
+	}
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Couldn't decode response: %v\n", err)
+		}
+	}
+	return body.Data, body.Meta, w.Code
+}
+
+/**
+ * Function to get the user names of the users
+ */
+func userNames(users []models.User) []string {
+	names := []string{}
+	for _, user := range users {
+		names = append(names, user.UserName)
+	}
+	return names
+}
+
+/**
+ * Function to test the limit and offset pagination
+ * case: success
+ */
+func TestListUsersOffset(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	setupPaginationRoutes(r, t, store)
+
+	users, meta, code := listUsers(r, t, url.Values{"limit": {"2"}, "offset": {"2"}})
+	if code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, code)
+	}
+	if names := fmt.Sprint(userNames(users)); names != "[carol dave]" {
+		t.Fatalf("Expected to get carol and dave but instead got %s\n", names)
+	}
+	if meta.Total != 5 || meta.Limit != 2 || meta.Offset != 2 || meta.NextCursor == "" {
+		t.Fatalf("Unexpected page metadata %+v\n", meta)
+	}
+
+	_, _, code = listUsers(r, t, url.Values{"limit": {"500"}})
+	if code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusUnprocessableEntity, code)
+	}
+}
+
+/**
+ * Function to test walking every page with the cursor
+ * case: success with null values sorted last
+ */
+func TestListUsersCursor(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	setupPaginationRoutes(r, t, store)
+
+	for sort, expected := range map[string]string{
+		"dob":        "[alice bob carol erin dave]",
+		"-dob":       "[erin carol bob alice dave]",
+		"-user_name": "[erin dave carol bob alice]",
+		"id":         "[alice bob carol dave erin]",
+	} {
+		var names []string
+		query := url.Values{"limit": {"2"}, "sort": {sort}}
+		for page := 0; page < 5; page++ {
+			users, meta, code := listUsers(r, t, query)
+			if code != http.StatusOK {
+				t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, code)
+			}
+			names = append(names, userNames(users)...)
+			if meta.NextCursor == "" {
+				break
+			}
+			query.Set("cursor", meta.NextCursor)
+		}
+		if fmt.Sprint(names) != expected {
+			t.Fatalf("Expected to get %s sorted by %s but instead got %v\n", expected, sort, names)
+		}
+	}
+
+	// A cursor is only valid for the sort it was created with
+	_, meta, _ := listUsers(r, t, url.Values{"limit": {"2"}, "sort": {"dob"}})
+	_, _, code := listUsers(r, t, url.Values{"cursor": {meta.NextCursor}, "sort": {"full_name"}})
+	if code != http.StatusBadRequest {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusBadRequest, code)
+	}
+
+	_, _, code = listUsers(r, t, url.Values{"sort": {"password"}})
+	if code != http.StatusBadRequest {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusBadRequest, code)
+	}
+}
+
+/**
+ * Function to test the filters of the user list
+ * case: success
+ */
+func TestListUsersFilters(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	setupPaginationRoutes(r, t, store)
+
+	users, meta, _ := listUsers(r, t, url.Values{"dob_from": {"1991-01-01"}, "dob_to": {"1992-01-01"}})
+	if names := fmt.Sprint(userNames(users)); names != "[bob carol]" || meta.Total != 2 {
+		t.Fatalf("Expected to get bob and carol but instead got %s\n", names)
+	}
+
+	users, _, _ = listUsers(r, t, url.Values{"user_name": {"AR"}})
+	if names := fmt.Sprint(userNames(users)); names != "[carol]" {
+		t.Fatalf("Expected to get carol but instead got %s\n", names)
+	}
+
+	created := time.Now().Add(time.Hour).Format(time.RFC3339)
+	users, _, _ = listUsers(r, t, url.Values{"created_from": {created}})
+	if len(users) != 0 {
+		t.Fatalf("Expected to get no users but instead got %v\n", userNames(users))
+	}
+
+	_, _, code := listUsers(r, t, url.Values{"dob_from": {"yesterday"}})
+	if code != http.StatusBadRequest {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusBadRequest, code)
+	}
+}
@@ -0,0 +1,239 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"ionixx/api/controllers"
+	"ionixx/api/middlewares"
+	"ionixx/api/models"
+	"ionixx/api/notify"
+	"ionixx/api/response"
+	"ionixx/api/storage"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+/**
+ * Function to setup the password reset routes, the reset tokens are sent to the returned notifier
+ * once the returned controller is drained
+ */
+func setupPasswordRoutes(r *gin.Engine, store *storage.Store) (*notify.MemoryNotifier, *controllers.PasswordController) {
+	notifier := &notify.MemoryNotifier{}
+	authController := controllers.NewAuthController(store, TestAuthConfig, TestKeys)
+	sessionController := controllers.NewSessionController(store)
+	passwordController := controllers.NewPasswordController(store, TestAuthConfig, notifier)
+	r.POST("/login", authController.Login)
+	r.POST("/password/forgot", passwordController.ForgotPassword)
+	r.POST("/password/reset", passwordController.ResetPassword)
+	r.GET("/sessions", middlewares.AuthMiddleware(store, TestKeys), sessionController.GetSessions)
+	r.PUT("/:id/password", middlewares.AuthMiddleware(store, TestKeys), middlewares.Self, passwordController.ChangePassword)
+	return notifier, passwordController
+}
+
+/**
+ * Function to test the password reset flow
+ * case: success, the token is single use and sessions are revoked
+ */
+func TestPasswordReset(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	notifier, passwordController := setupPasswordRoutes(r, store)
+	user := CreateTestUser(t, store, "forgetful", "old#123", models.RoleMember)
+	user.Email = "forgetful@example.com"
+	store.Users.Update(&user, "email")
+	session := LoginUser(r, t, "forgetful", "old#123")
+
+	data, _ := json.Marshal(controllers.ForgotPasswordRequest{Email: "forgetful@example.com"})
+	w := PerformAuthorizedRequest(r, t, http.MethodPost, "/password/forgot", "", data)
+	fmt.Println(w.Body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+
+	// Read the token from the sent message
+	passwordController.Drain(context.Background())
+	messages := notifier.Messages()
+	if len(messages) != 1 || messages[0].To != "forgetful@example.com" {
+		t.Fatalf("Expected one message to the user but got %v\n", messages)
+	}
+	match := regexp.MustCompile(`Reset token: (\S+)`).FindStringSubmatch(messages[0].Body)
+	if match == nil {
+		t.Fatalf("Expected the message to contain the reset token\n")
+	}
+
+	data, _ = json.Marshal(controllers.ResetPasswordRequest{Token: match[1], Password: "new#123"})
+	w = PerformAuthorizedRequest(r, t, http.MethodPost, "/password/reset", "", data)
+	fmt.Println(w.Body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+
+	// The reset token can only be used once
+	w = PerformAuthorizedRequest(r, t, http.MethodPost, "/password/reset", "", data)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusBadRequest, w.Code)
+	}
+
+	// The session opened with the old password is revoked
+	w = PerformAuthorizedRequest(r, t, http.MethodGet, "/sessions", session.AccessToken, nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusUnauthorized, w.Code)
+	}
+
+	LoginUser(r, t, "forgetful", "new#123")
+}
+
+/**
+ * Function to test the forgot password endpoint
+ * case: unknown users get the same response and no message
+ */
+func TestForgotPasswordUnknownUser(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	notifier, passwordController := setupPasswordRoutes(r, store)
+
+	data, _ := json.Marshal(controllers.ForgotPasswordRequest{UserName: "nobody"})
+	w := PerformAuthorizedRequest(r, t, http.MethodPost, "/password/forgot", "", data)
+	fmt.Println(w.Body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+
+	passwordController.Drain(context.Background())
+	if messages := notifier.Messages(); len(messages) != 0 {
+		t.Fatalf("Expected no messages but got %v\n", messages)
+	}
+}
+
+// blockingNotifier holds every message until it is released, like a slow mail server
+type blockingNotifier struct {
+	release chan struct{}
+	notify.MemoryNotifier
+}
+
+/**
+ * Function to store the message once the notifier is released
+ */
+func (b *blockingNotifier) Send(message notify.Message) error {
+	<-b.release
+	return b.MemoryNotifier.Send(message)
+}
+
+/**
+ * Function to test the forgot password response doesn't wait for the reset token to be sent
+ * case: success, known users get their response before the mail server answers
+ */
+func TestForgotPasswordInBackground(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	notifier := &blockingNotifier{release: make(chan struct{})}
+	passwordController := controllers.NewPasswordController(store, TestAuthConfig, notifier)
+	r.POST("/password/forgot", passwordController.ForgotPassword)
+	user := CreateTestUser(t, store, "waiting", "waiting#123", models.RoleMember)
+	user.Email = "waiting@example.com"
+	store.Users.Update(&user, "email")
+
+	data, _ := json.Marshal(controllers.ForgotPasswordRequest{UserName: "waiting"})
+	w := PerformAuthorizedRequest(r, t, http.MethodPost, "/password/forgot", "", data)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+
+	close(notifier.release)
+	passwordController.Drain(context.Background())
+	if messages := notifier.Messages(); len(messages) != 1 || messages[0].To != "waiting@example.com" {
+		t.Fatalf("Expected one message to the user but got %v\n", messages)
+	}
+}
+
+/**
+ * Function to test the forgot password endpoint is throttled
+ * case: too many requests for one account, known or not, back off while other accounts don't
+ */
+func TestForgotPasswordThrottled(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	notifier, passwordController := setupPasswordRoutes(r, store)
+	user := CreateTestUser(t, store, "bombed", "bombed#123", models.RoleMember)
+	user.Email = "bombed@example.com"
+	store.Users.Update(&user, "email")
+
+	for _, userName := range []string{"bombed", "nobody"} {
+		data, _ := json.Marshal(controllers.ForgotPasswordRequest{UserName: userName})
+		for i := 0; i < 3; i++ {
+			w := PerformAuthorizedRequest(r, t, http.MethodPost, "/password/forgot", "", data)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+			}
+		}
+		w := PerformAuthorizedRequest(r, t, http.MethodPost, "/password/forgot", "", data)
+		decodeProblem(t, w, http.StatusTooManyRequests, response.CodeTooManyAttempts)
+		if w.Header().Get("Retry-After") == "" {
+			t.Fatalf("Expected the Retry-After header to be set\n")
+		}
+	}
+
+	passwordController.Drain(context.Background())
+	if messages := notifier.Messages(); len(messages) != 3 {
+		t.Fatalf("Expected three messages but got %d\n", len(messages))
+	}
+}
+
+/**
+ * Function to test the change password endpoint
+ * case: the current password is checked and other sessions are revoked
+ */
+func TestChangePassword(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	setupPasswordRoutes(r, store)
+	user := CreateTestUser(t, store, "changer", "old#123", models.RoleMember)
+	other := CreateTestUser(t, store, "other", "other#123", models.RoleMember)
+	laptop := LoginUser(r, t, "changer", "old#123")
+	phone := LoginUser(r, t, "changer", "old#123")
+	path := fmt.Sprintf("/%d/password", user.ID)
+
+	data, _ := json.Marshal(controllers.ChangePasswordRequest{CurrentPassword: "wrong#123", NewPassword: "new#123"})
+	w := PerformAuthorizedRequest(r, t, http.MethodPut, path, laptop.AccessToken, data)
+	fmt.Println(w.Body)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusBadRequest, w.Code)
+	}
+
+	// The new password must follow the same rules as on sign up
+	data, _ = json.Marshal(controllers.ChangePasswordRequest{CurrentPassword: "old#123", NewPassword: "new"})
+	w = PerformAuthorizedRequest(r, t, http.MethodPut, path, laptop.AccessToken, data)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusUnprocessableEntity, w.Code)
+	}
+
+	// Users can not change the password of someone else
+	data, _ = json.Marshal(controllers.ChangePasswordRequest{CurrentPassword: "other#123", NewPassword: "new#123"})
+	w = PerformAuthorizedRequest(r, t, http.MethodPut, fmt.Sprintf("/%d/password", other.ID), laptop.AccessToken, data)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusForbidden, w.Code)
+	}
+
+	data, _ = json.Marshal(controllers.ChangePasswordRequest{CurrentPassword: "old#123", NewPassword: "new#123"})
+	w = PerformAuthorizedRequest(r, t, http.MethodPut, path, laptop.AccessToken, data)
+	fmt.Println(w.Body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+
+	// The current session stays logged in while the other session is revoked
+	w = PerformAuthorizedRequest(r, t, http.MethodGet, "/sessions", laptop.AccessToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+	w = PerformAuthorizedRequest(r, t, http.MethodGet, "/sessions", phone.AccessToken, nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusUnauthorized, w.Code)
+	}
+
+	LoginUser(r, t, "changer", "new#123")
+}
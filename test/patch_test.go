@@ -0,0 +1,119 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"ionixx/api/controllers"
+	"ionixx/api/models"
+	"ionixx/api/response"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+/**
+ * Function to perform a patch request with the content type of the patch
+ */
+func performPatch(r *gin.Engine, t *testing.T, path string, contentType string, patch string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(http.MethodPatch, path, bytes.NewReader([]byte(patch)))
+	if err != nil {
+		t.Fatalf("Couldn't create request: %v\n", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	// Create a response recorder to inspect the response
+	w := httptest.NewRecorder()
+
+	// Perform the request
+	r.ServeHTTP(w, req)
+	fmt.Println(w.Body)
+	return w
+}
+
+/**
+ * Function to test patching a user
+ * case: success, null and removed fields are cleared with both patch formats
+ */
+func TestPatchUser(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	userController := controllers.NewUserController(store, TestAuthConfig)
+	r.PATCH("/:id", userController.PatchUserById)
+	user := CreateTestUser(t, store, "patched", "patched#123", models.RoleMember)
+	dob := time.Date(1990, time.January, 1, 0, 0, 0, 0, time.UTC)
+	user.Dob = &dob
+	user.LinkedinURL = "https://linkedin.com/in/patched"
+	user.Email = "patched@example.com"
+	if err := store.Users.Update(&user, "dob", "linkedin_url", "email"); err != nil {
+		t.Fatalf("Couldn't update user: %v\n", err)
+	}
+	path := fmt.Sprintf("/%d", user.ID)
+
+	w := performPatch(r, t, path, controllers.MergePatchContentType, `{"full_name": "Merge Patched", "linkedin_url": null}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+	stored, _ := store.Users.FindByID(user.ID)
+	if stored.FullName != "Merge Patched" || stored.LinkedinURL != "" || stored.Dob == nil || stored.Email != "patched@example.com" {
+		t.Fatalf("Expected the merge patch to change only the given fields but instead got %+v\n", stored)
+	}
+
+	w = performPatch(r, t, path, controllers.JSONPatchContentType,
+		`[{"op": "test", "path": "/user_name", "value": "patched"}, {"op": "replace", "path": "/full_name", "value": "JSON Patched"}, {"op": "remove", "path": "/dob"}]`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+	stored, _ = store.Users.FindByID(user.ID)
+	if stored.FullName != "JSON Patched" || stored.Dob != nil || stored.Email != "patched@example.com" {
+		t.Fatalf("Expected the json patch to clear the dob but instead got %+v\n", stored)
+	}
+}
+
+/**
+ * Function to test patches that are rejected
+ * case: failed, immutable and unknown fields, invalid values, failed tests and other content types
+ */
+func TestPatchUserFailed(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	userController := controllers.NewUserController(store, TestAuthConfig)
+	r.PATCH("/:id", userController.PatchUserById)
+	user := CreateTestUser(t, store, "unpatched", "unpatched#123", models.RoleMember)
+	path := fmt.Sprintf("/%d", user.ID)
+
+	for _, test := range []struct {
+		contentType string
+		patch       string
+		status      int
+		code        string
+		field       string
+	}{
+		{controllers.MergePatchContentType, `{"user_name": "renamed"}`, http.StatusUnprocessableEntity, response.CodeValidationFailed, "user_name"},
+		{controllers.MergePatchContentType, `{"created_at": null}`, http.StatusUnprocessableEntity, response.CodeValidationFailed, "created_at"},
+		{controllers.MergePatchContentType, `{"role": "admin"}`, http.StatusUnprocessableEntity, response.CodeValidationFailed, "role"},
+		{controllers.MergePatchContentType, `{"full_name": null}`, http.StatusUnprocessableEntity, response.CodeValidationFailed, "full_name"},
+		{controllers.MergePatchContentType, `{"email": "not an email"}`, http.StatusUnprocessableEntity, response.CodeValidationFailed, "email"},
+		{controllers.JSONPatchContentType, `[{"op": "replace", "path": "/id", "value": 42}]`, http.StatusUnprocessableEntity, response.CodeValidationFailed, "id"},
+		{controllers.JSONPatchContentType, `[{"op": "test", "path": "/full_name", "value": "someone else"}]`, http.StatusConflict, response.CodePatchConflict, ""},
+		{controllers.JSONPatchContentType, `{"op": "remove"}`, http.StatusBadRequest, response.CodeInvalidRequest, ""},
+		{"application/json", `{"full_name": "Plain"}`, http.StatusUnsupportedMediaType, response.CodeUnsupportedMediaType, ""},
+	} {
+		w := performPatch(r, t, path, test.contentType, test.patch)
+		problem := decodeProblem(t, w, test.status, test.code)
+		if test.field != "" && (len(problem.Errors) != 1 || problem.Errors[0].Field != test.field) {
+			t.Fatalf("Expected the field %s to be rejected but instead got %+v\n", test.field, problem.Errors)
+		}
+	}
+
+	// Nothing was changed by the rejected patches
+	stored, _ := store.Users.FindByID(user.ID)
+	if stored.UserName != "unpatched" || stored.Role != models.RoleMember || stored.FullName != "unpatched" {
+		t.Fatalf("Expected the user to be unchanged but instead got %+v\n", stored)
+	}
+
+	w := performPatch(r, t, "/4242", controllers.MergePatchContentType, `{"full_name": "Nobody"}`)
+	decodeProblem(t, w, http.StatusNotFound, response.CodeUserNotFound)
+}
@@ -0,0 +1,114 @@
+package test
+
+import (
+	"encoding/json"
+	"ionixx/api/controllers"
+	"ionixx/api/logging"
+	"ionixx/api/models"
+	"ionixx/api/response"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+/**
+ * Function to decode the problem of an error response and check its status and code
+ */
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder, status int, code string) response.Problem {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("Expected to get status %d but instead got %d\n", status, w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != response.ProblemContentType {
+		t.Fatalf("Expected the content type %s but instead got %s\n", response.ProblemContentType, contentType)
+	}
+	var problem response.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("Couldn't decode the problem %s: %v\n", w.Body, err)
+	}
+	if problem.Status != status || problem.Code != code || problem.Title != http.StatusText(status) {
+		t.Fatalf("Expected a %d problem with the code %s but instead got %+v\n", status, code, problem)
+	}
+	if problem.RequestID == "" || problem.RequestID != w.Header().Get(logging.RequestIDHeader) {
+		t.Fatalf("Expected the problem to have the request id but instead got %+v\n", problem)
+	}
+	return problem
+}
+
+/**
+ * Function to test the problem of invalid fields
+ * case: failed, the fields failing validation are listed
+ */
+func TestProblemValidation(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	userController := controllers.NewUserController(store, TestAuthConfig)
+	r.POST("/", userController.CreateUser)
+	r.GET("/", userController.GetAllUsers)
+
+	data, err := GetInvalidUserPayload()
+	if err != nil {
+		t.Fatalf("Couldn't create request: %v\n", err)
+	}
+	w := PerformAuthorizedRequest(r, t, http.MethodPost, "/", "", data)
+	problem := decodeProblem(t, w, http.StatusUnprocessableEntity, response.CodeValidationFailed)
+	// Every field failing validation is listed with its json name, not just the first one
+	fields := map[string]response.FieldError{}
+	for _, fieldError := range problem.Errors {
+		fields[fieldError.Field] = fieldError
+	}
+	password := response.FieldError{Field: "password", Constraint: "min", Param: "6", Message: "password must be at least 6 characters in length"}
+	if len(fields) != 2 || fields["password"] != password || fields["dob"].Constraint != "required" || fields["dob"].Message == "" {
+		t.Fatalf("Expected the password and dob to fail validation but instead got %+v\n", problem.Errors)
+	}
+
+	// A body that is not json can't be validated at all
+	w = PerformAuthorizedRequest(r, t, http.MethodPost, "/", "", []byte("{"))
+	decodeProblem(t, w, http.StatusBadRequest, response.CodeInvalidRequest)
+
+	// Query fields are named as in the query string
+	w = PerformAuthorizedRequest(r, t, http.MethodGet, "/?limit=500", "", nil)
+	problem = decodeProblem(t, w, http.StatusUnprocessableEntity, response.CodeValidationFailed)
+	if len(problem.Errors) != 1 || problem.Errors[0].Field != "limit" || problem.Errors[0].Param != "100" {
+		t.Fatalf("Expected the limit to fail validation but instead got %+v\n", problem.Errors)
+	}
+}
+
+/**
+ * Function to test the problem of a duplicate user name
+ * case: failed, the second user with the name is a conflict
+ */
+func TestProblemDuplicateUserName(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	userController := controllers.NewUserController(store, TestAuthConfig)
+	r.POST("/", userController.CreateUser)
+
+	data, err := GetUserPayload()
+	if err != nil {
+		t.Fatalf("Couldn't create request: %v\n", err)
+	}
+	if w := PerformAuthorizedRequest(r, t, http.MethodPost, "/", "", data); w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+	w := PerformAuthorizedRequest(r, t, http.MethodPost, "/", "", data)
+	decodeProblem(t, w, http.StatusConflict, response.CodeUserNameTaken)
+}
+
+/**
+ * Function to test the problem of a missing user
+ * case: failed, unknown users are not found
+ */
+func TestProblemUserNotFound(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	userController := controllers.NewUserController(store, TestAuthConfig)
+	r.GET("/:id", userController.GetUserByID)
+	CreateTestUser(t, store, "finder", "finder#123", models.RoleMember)
+
+	w := PerformAuthorizedRequest(r, t, http.MethodGet, "/4242", "", nil)
+	problem := decodeProblem(t, w, http.StatusNotFound, response.CodeUserNotFound)
+	if problem.Instance != "/4242" {
+		t.Fatalf("Expected the problem instance /4242 but instead got %s\n", problem.Instance)
+	}
+}
@@ -0,0 +1,137 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ionixx/api/controllers"
+	"ionixx/api/response"
+	"ionixx/api/storage"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+/**
+ * Function to exchange a refresh token at the /refresh endpoint
+ */
+func performRefresh(r *gin.Engine, t *testing.T, refreshToken string) *httptest.ResponseRecorder {
+	data, err := json.Marshal(controllers.RefreshRequest{RefreshToken: refreshToken})
+	if err != nil {
+		t.Fatalf("Couldn't create request: %v\n", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "/refresh", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Couldn't create request: %v\n", err)
+	}
+
+	// Create a response recorder to inspect the response
+	w := httptest.NewRecorder()
+
+	// Perform the request
+	r.ServeHTTP(w, req)
+	fmt.Println(w.Body)
+	return w
+}
+
+/**
+ * Function to test the refresh endpoint
+ * case: refresh with a valid refresh token
+ */
+func TestRefreshSuccess(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	authController := controllers.NewAuthController(store, TestAuthConfig, TestKeys)
+	r.POST("/login", authController.Login)
+	r.POST("/refresh", authController.Refresh)
+	SeedNewUser(r, t, store)
+
+	loginResponse := LoginSeededUser(r, t)
+
+	w := performRefresh(r, t, loginResponse.RefreshToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+
+	var tokens controllers.TokenResponse
+	DecodeResponseData(t, w, &tokens)
+	if tokens.RefreshToken == "" || tokens.RefreshToken == loginResponse.RefreshToken {
+		t.Fatalf("Expected the refresh token to be rotated\n")
+	}
+}
+
+/**
+ * Function to test the refresh endpoint
+ * case: reusing a rotated refresh token revokes the whole family
+ */
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	authController := controllers.NewAuthController(store, TestAuthConfig, TestKeys)
+	r.POST("/login", authController.Login)
+	r.POST("/refresh", authController.Refresh)
+	SeedNewUser(r, t, store)
+
+	loginResponse := LoginSeededUser(r, t)
+
+	// Rotate the refresh token once
+	w := performRefresh(r, t, loginResponse.RefreshToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+	var tokens controllers.TokenResponse
+	DecodeResponseData(t, w, &tokens)
+
+	// Reuse the already rotated refresh token
+	w = performRefresh(r, t, loginResponse.RefreshToken)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusUnauthorized, w.Code)
+	}
+
+	// The latest refresh token of the family must be revoked as well
+	w = performRefresh(r, t, tokens.RefreshToken)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusUnauthorized, w.Code)
+	}
+}
+
+// failingRevoke fails to revoke sessions, like a database going away during the request
+type failingRevoke struct {
+	storage.SessionRepository
+}
+
+func (failingRevoke) Revoke(sessionID uint) error {
+	return errors.New("connection refused")
+}
+
+/**
+ * Function to test the refresh endpoint
+ * case: failed, the family of a reused refresh token can't be revoked
+ */
+func TestRefreshReuseRevokeFailed(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	//Built from the repositories so WithContext doesn't rebuild them from the database
+	broken := storage.Store{
+		Users:    store.Users,
+		Sessions: failingRevoke{store.Sessions},
+		Tokens:   store.Tokens,
+	}
+	authController := controllers.NewAuthController(&broken, TestAuthConfig, TestKeys)
+	r.POST("/login", authController.Login)
+	r.POST("/refresh", authController.Refresh)
+	SeedNewUser(r, t, store)
+
+	loginResponse := LoginSeededUser(r, t)
+	if w := performRefresh(r, t, loginResponse.RefreshToken); w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+
+	// The client must not be told the family is revoked when it isn't
+	w := performRefresh(r, t, loginResponse.RefreshToken)
+	decodeProblem(t, w, http.StatusInternalServerError, response.CodeInternalError)
+}
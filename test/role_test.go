@@ -0,0 +1,249 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"ionixx/api/controllers"
+	"ionixx/api/middlewares"
+	"ionixx/api/models"
+	"ionixx/api/response"
+	"ionixx/api/storage"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+/**
+ * Function to setup the user routes guarded by roles
+ */
+func setupRoleRoutes(r *gin.Engine, store *storage.Store) {
+	authController := controllers.NewAuthController(store, TestAuthConfig, TestKeys)
+	userController := controllers.NewUserController(store, TestAuthConfig)
+	r.POST("/login", authController.Login)
+	r.PUT("/:id", middlewares.AuthMiddleware(store, TestKeys), middlewares.SelfOrAdmin, userController.UpdateUserById)
+	r.DELETE("/:id", middlewares.AuthMiddleware(store, TestKeys), middlewares.SelfOrAdmin, userController.DeleteUserById)
+	r.PUT("/:id/role", middlewares.AuthMiddleware(store, TestKeys), middlewares.RequireRole(models.RoleAdmin), userController.UpdateUserRole)
+}
+
+/**
+ * Function to test that members can only modify themselves
+ * case: forbidden for other users
+ */
+func TestMemberCanOnlyModifySelf(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	setupRoleRoutes(r, store)
+	member := CreateTestUser(t, store, "member", "member#123", models.RoleMember)
+	other := CreateTestUser(t, store, "other", "other#123", models.RoleMember)
+	tokens := LoginUser(r, t, "member", "member#123")
+
+	data, _ := json.Marshal(controllers.UpdateUserRequest{FullName: "Changed"})
+
+	w := PerformAuthorizedRequest(r, t, http.MethodPut, fmt.Sprintf("/%d", other.ID), tokens.AccessToken, data)
+	fmt.Println(w.Body)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusForbidden, w.Code)
+	}
+
+	w = PerformAuthorizedRequest(r, t, http.MethodDelete, fmt.Sprintf("/%d", other.ID), tokens.AccessToken, nil)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusForbidden, w.Code)
+	}
+
+	w = PerformAuthorizedRequest(r, t, http.MethodPut, fmt.Sprintf("/%d", member.ID), tokens.AccessToken, data)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+
+	roleData, _ := json.Marshal(controllers.UpdateUserRoleRequest{Role: models.RoleAdmin})
+	w = PerformAuthorizedRequest(r, t, http.MethodPut, fmt.Sprintf("/%d/role", member.ID), tokens.AccessToken, roleData)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusForbidden, w.Code)
+	}
+}
+
+/**
+ * Function to test that admins can manage every user
+ * case: success
+ */
+func TestAdminCanManageUsers(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	setupRoleRoutes(r, store)
+	CreateTestUser(t, store, "admin", "admin#123", models.RoleAdmin)
+	member := CreateTestUser(t, store, "member", "member#123", models.RoleMember)
+	other := CreateTestUser(t, store, "other", "other#123", models.RoleMember)
+	tokens := LoginUser(r, t, "admin", "admin#123")
+
+	data, _ := json.Marshal(controllers.UpdateUserRequest{FullName: "Changed"})
+	w := PerformAuthorizedRequest(r, t, http.MethodPut, fmt.Sprintf("/%d", member.ID), tokens.AccessToken, data)
+	fmt.Println(w.Body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+
+	roleData, _ := json.Marshal(controllers.UpdateUserRoleRequest{Role: models.RoleAdmin})
+	w = PerformAuthorizedRequest(r, t, http.MethodPut, fmt.Sprintf("/%d/role", member.ID), tokens.AccessToken, roleData)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+
+	w = PerformAuthorizedRequest(r, t, http.MethodDelete, fmt.Sprintf("/%d", other.ID), tokens.AccessToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+
+	// The promoted member carries the admin role after logging in again
+	promoted := LoginUser(r, t, "member", "member#123")
+	w = PerformAuthorizedRequest(r, t, http.MethodPut, fmt.Sprintf("/%d/role", member.ID), promoted.AccessToken, roleData)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+}
+
+/**
+ * Function to test promoting the first admin of a deployment
+ * case: success, the promoted user can change roles and unknown users are not found
+ */
+func TestPromoteToAdmin(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	setupRoleRoutes(r, store)
+	first := CreateTestUser(t, store, "first", "first#123", models.RoleMember)
+	member := CreateTestUser(t, store, "member", "member#123", models.RoleMember)
+	stale := LoginUser(r, t, "first", "first#123")
+
+	user, err := controllers.PromoteToAdmin(store, "first")
+	if err != nil || user.ID != first.ID || user.Role != models.RoleAdmin {
+		t.Fatalf("Expected the user to be promoted but instead got %+v, %v\n", user, err)
+	}
+	if _, err := controllers.PromoteToAdmin(store, "nobody"); err != storage.ErrNotFound {
+		t.Fatalf("Expected to get %v but instead got %v\n", storage.ErrNotFound, err)
+	}
+
+	// The token of the member role was revoked with the sessions of the user
+	roleData, _ := json.Marshal(controllers.UpdateUserRoleRequest{Role: models.RoleAdmin})
+	w := PerformAuthorizedRequest(r, t, http.MethodPut, fmt.Sprintf("/%d/role", member.ID), stale.AccessToken, roleData)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusUnauthorized, w.Code)
+	}
+	tokens := LoginUser(r, t, "first", "first#123")
+	w = PerformAuthorizedRequest(r, t, http.MethodPut, fmt.Sprintf("/%d/role", member.ID), tokens.AccessToken, roleData)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+}
+
+/**
+ * Function to test the private fields of users are only shown to the user themself and admins
+ * case: success, the public list, for admins too, and other members get the profile only
+ */
+func TestUserPrivateFields(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	setupRoleRoutes(r, store)
+	userController := controllers.NewUserController(store, TestAuthConfig)
+	r.GET("/", userController.GetAllUsers)
+	r.GET("/:id", middlewares.AuthMiddleware(store, TestKeys), userController.GetUserByID)
+	CreateTestUser(t, store, "admin", "admin#123", models.RoleAdmin)
+	CreateTestUser(t, store, "member", "member#123", models.RoleMember)
+	private := CreateTestUser(t, store, "private", "private#123", models.RoleMember)
+	private.Email = "private@example.com"
+	if err := store.Users.Update(&private, "email"); err != nil {
+		t.Fatalf("Couldn't update user: %v\n", err)
+	}
+	path := fmt.Sprintf("/%d", private.ID)
+
+	for _, test := range []struct {
+		name    string
+		path    string
+		login   string
+		private bool
+	}{
+		{"anonymous list", "/", "", false},
+		{"other member", path, "member", false},
+		{"the user themself", path, "private", true},
+		{"admin", path, "admin", true},
+		{"admin list", "/", "admin", false},
+	} {
+		token := ""
+		if test.login != "" {
+			token = LoginUser(r, t, test.login, test.login+"#123").AccessToken
+		}
+		w := PerformAuthorizedRequest(r, t, http.MethodGet, test.path, token, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected to get status %d but instead got %d\n", test.name, http.StatusOK, w.Code)
+		}
+		body := w.Body.String()
+		for _, field := range []string{`"private@example.com"`, `"role"`, `"mfa_enabled"`, `"failed_login_attempts"`, `"locked_until"`} {
+			if strings.Contains(body, field) != test.private {
+				t.Fatalf("%s: expected %s to be shown %v but instead got %s\n", test.name, field, test.private, body)
+			}
+		}
+	}
+}
+
+/**
+ * Function to test changing the email, the password reset mail goes to it
+ * case: owners confirm with their password, admins don't, a taken email conflicts
+ */
+func TestEmailChange(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	setupRoleRoutes(r, store)
+	userController := controllers.NewUserController(store, TestAuthConfig)
+	r.POST("/", userController.CreateUser)
+	r.PATCH("/:id", middlewares.AuthMiddleware(store, TestKeys), middlewares.SelfOrAdmin, userController.PatchUserById)
+	CreateTestUser(t, store, "admin", "admin#123", models.RoleAdmin)
+	victim := CreateTestUser(t, store, "victim", "victim#123", models.RoleMember)
+	claimer := CreateTestUser(t, store, "claimer", "claimer#123", models.RoleMember)
+	victimToken := LoginUser(r, t, "victim", "victim#123").AccessToken
+	claimerToken := LoginUser(r, t, "claimer", "claimer#123").AccessToken
+	adminToken := LoginUser(r, t, "admin", "admin#123").AccessToken
+	claimerPath := fmt.Sprintf("/%d", claimer.ID)
+
+	data, _ := json.Marshal(controllers.UpdateUserRequest{Email: "victim@example.com", CurrentPassword: "victim#123"})
+	w := PerformAuthorizedRequest(r, t, http.MethodPut, fmt.Sprintf("/%d", victim.ID), victimToken, data)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+
+	// The email of another user can't be claimed, even with the right password
+	data, _ = json.Marshal(controllers.UpdateUserRequest{Email: "victim@example.com", CurrentPassword: "claimer#123"})
+	w = PerformAuthorizedRequest(r, t, http.MethodPut, claimerPath, claimerToken, data)
+	decodeProblem(t, w, http.StatusConflict, response.CodeEmailTaken)
+	data, _ = json.Marshal(controllers.CreateUserRequest{UserName: "newcomer", Password: "newcomer#123", FullName: "Newcomer", Email: "victim@example.com", Dob: time.Now(), LinkedinURL: "https://linkedin.com/in/newcomer"})
+	w = PerformAuthorizedRequest(r, t, http.MethodPost, "/", "", data)
+	decodeProblem(t, w, http.StatusConflict, response.CodeEmailTaken)
+
+	// Owners confirm a new email with their password
+	for _, password := range []string{"", "wrong#123"} {
+		data, _ = json.Marshal(controllers.UpdateUserRequest{Email: "claimer@example.com", CurrentPassword: password})
+		w = PerformAuthorizedRequest(r, t, http.MethodPut, claimerPath, claimerToken, data)
+		decodeProblem(t, w, http.StatusBadRequest, response.CodeWrongCurrentPassword)
+	}
+	patch := []byte(`{"email": "claimer@example.com", "current_password": "claimer#123"}`)
+	req, _ := http.NewRequest(http.MethodPatch, claimerPath, bytes.NewReader(patch))
+	req.Header.Set("Authorization", "Bearer "+claimerToken)
+	req.Header.Set("Content-Type", controllers.MergePatchContentType)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+
+	// Admins change the email of other users without their password
+	data, _ = json.Marshal(controllers.UpdateUserRequest{Email: "claimer@example.org"})
+	w = PerformAuthorizedRequest(r, t, http.MethodPut, claimerPath, adminToken, data)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+	if stored, _ := store.Users.FindByID(claimer.ID); stored.Email != "claimer@example.org" {
+		t.Fatalf("Expected the email to be claimer@example.org but instead got %s\n", stored.Email)
+	}
+}
@@ -0,0 +1,102 @@
+package test
+
+import (
+	"fmt"
+	"ionixx/api/controllers"
+	"ionixx/api/middlewares"
+	"ionixx/api/models"
+	"ionixx/api/storage"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+/**
+ * Function to setup the user search route next to the user by id route
+ */
+func setupSearchRoutes(r *gin.Engine, store *storage.Store) {
+	authController := controllers.NewAuthController(store, TestAuthConfig, TestKeys)
+	userController := controllers.NewUserController(store, TestAuthConfig)
+	r.POST("/login", authController.Login)
+	r.GET("/search", middlewares.AuthMiddleware(store, TestKeys), userController.SearchUsers)
+	r.GET("/:id", middlewares.AuthMiddleware(store, TestKeys), userController.GetUserByID)
+}
+
+/**
+ * Function to test the user search
+ * case: success with the best match first
+ */
+func TestSearchUsers(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	setupSearchRoutes(r, store)
+	CreateTestUser(t, store, "searcher", "searcher#123", models.RoleMember)
+	jane := CreateTestUser(t, store, "jdoe", "jdoe#123", models.RoleMember)
+	jane.FullName = "Jane Doe"
+	jane.LinkedinURL = "https://linkedin.com/in/janedoe"
+	store.Users.Update(&jane, "full_name", "linkedin_url")
+	john := CreateTestUser(t, store, "jsmith", "jsmith#123", models.RoleMember)
+	john.FullName = "John Doe"
+	store.Users.Update(&john, "full_name")
+	tokens := LoginUser(r, t, "searcher", "searcher#123")
+
+	w := PerformAuthorizedRequest(r, t, http.MethodGet, "/search?"+url.Values{"q": {"jane doe"}}.Encode(), tokens.AccessToken, nil)
+	fmt.Println(w.Body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+	var results []models.UserSearchResult
+	DecodeResponseData(t, w, &results)
+	if len(results) != 1 || results[0].UserName != "jdoe" {
+		t.Fatalf("Expected to find jdoe but instead got %+v\n", results)
+	}
+	if !strings.Contains(results[0].Highlight.FullName, "<mark>") {
+		t.Fatalf("Expected the full name to be highlighted but instead got %q\n", results[0].Highlight.FullName)
+	}
+
+	w = PerformAuthorizedRequest(r, t, http.MethodGet, "/search?q=doe", tokens.AccessToken, nil)
+	DecodeResponseData(t, w, &results)
+	if len(results) != 2 || results[0].UserName != "jdoe" {
+		t.Fatalf("Expected to find jdoe first but instead got %+v\n", results)
+	}
+
+	w = PerformAuthorizedRequest(r, t, http.MethodGet, "/search", tokens.AccessToken, nil)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusUnprocessableEntity, w.Code)
+	}
+
+	// The search route does not hide the user by id route
+	w = PerformAuthorizedRequest(r, t, http.MethodGet, fmt.Sprintf("/%d", jane.ID), tokens.AccessToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+}
+
+/**
+ * Function to test the highlight of the user search is html escaped
+ * case: success, only the mark tags are html
+ */
+func TestSearchUsersHighlightEscaped(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	setupSearchRoutes(r, store)
+	CreateTestUser(t, store, "searcher", "searcher#123", models.RoleMember)
+	mallory := CreateTestUser(t, store, "mallory", "mallory#123", models.RoleMember)
+	mallory.FullName = `Mallory <img src=x onerror=alert(1)>`
+	store.Users.Update(&mallory, "full_name")
+	tokens := LoginUser(r, t, "searcher", "searcher#123")
+
+	w := PerformAuthorizedRequest(r, t, http.MethodGet, "/search?q=mallory", tokens.AccessToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+	var results []models.UserSearchResult
+	DecodeResponseData(t, w, &results)
+	expected := "<mark>Mallory</mark> &lt;img src=x onerror=alert(1)&gt;"
+	if len(results) != 1 || results[0].Highlight.FullName != expected {
+		t.Fatalf("Expected the highlight %q but instead got %+v\n", expected, results)
+	}
+}
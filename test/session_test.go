@@ -0,0 +1,90 @@
+package test
+
+import (
+	"fmt"
+	"ionixx/api/controllers"
+	"ionixx/api/middlewares"
+	"net/http"
+	"testing"
+)
+
+/**
+ * Function to test that logging in twice keeps both sessions active
+ * case: success
+ */
+func TestMultipleSessions(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	authController := controllers.NewAuthController(store, TestAuthConfig, TestKeys)
+	sessionController := controllers.NewSessionController(store)
+	r.POST("/login", authController.Login)
+	r.GET("/sessions", middlewares.AuthMiddleware(store, TestKeys), sessionController.GetSessions)
+	SeedNewUser(r, t, store)
+
+	laptop := LoginSeededUser(r, t)
+	phone := LoginSeededUser(r, t)
+
+	// The first token must still be valid after the second login
+	w := PerformAuthorizedRequest(r, t, http.MethodGet, "/sessions", laptop.AccessToken, nil)
+	fmt.Println(w.Body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+
+	var sessions []controllers.SessionResponse
+	DecodeResponseData(t, w, &sessions)
+	if len(sessions) != 2 {
+		t.Fatalf("Expected to get %d sessions but instead got %d\n", 2, len(sessions))
+	}
+
+	w = PerformAuthorizedRequest(r, t, http.MethodGet, "/sessions", phone.AccessToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+}
+
+/**
+ * Function to test revoking a session
+ * case: the revoked session token is rejected
+ */
+func TestRevokeSession(t *testing.T) {
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	authController := controllers.NewAuthController(store, TestAuthConfig, TestKeys)
+	sessionController := controllers.NewSessionController(store)
+	r.POST("/login", authController.Login)
+	r.GET("/sessions", middlewares.AuthMiddleware(store, TestKeys), sessionController.GetSessions)
+	r.DELETE("/sessions/:id", middlewares.AuthMiddleware(store, TestKeys), sessionController.RevokeSession)
+	SeedNewUser(r, t, store)
+
+	laptop := LoginSeededUser(r, t)
+	phone := LoginSeededUser(r, t)
+
+	// Find the session of the phone
+	w := PerformAuthorizedRequest(r, t, http.MethodGet, "/sessions", phone.AccessToken, nil)
+	var sessions []controllers.SessionResponse
+	DecodeResponseData(t, w, &sessions)
+	var phoneSessionID uint
+	for _, session := range sessions {
+		if session.Current {
+			phoneSessionID = session.ID
+		}
+	}
+
+	// Revoke the phone session from the laptop
+	w = PerformAuthorizedRequest(r, t, http.MethodDelete, fmt.Sprintf("/sessions/%d", phoneSessionID), laptop.AccessToken, nil)
+	fmt.Println(w.Body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+
+	w = PerformAuthorizedRequest(r, t, http.MethodGet, "/sessions", phone.AccessToken, nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusUnauthorized, w.Code)
+	}
+
+	w = PerformAuthorizedRequest(r, t, http.MethodGet, "/sessions", laptop.AccessToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+}
@@ -0,0 +1,55 @@
+package test
+
+import (
+	"ionixx/api/models"
+	"ionixx/api/storage"
+	"testing"
+	"time"
+)
+
+/**
+ * Function to test the in-memory store behaves like the database
+ * case: success
+ */
+func TestMemoryStore(t *testing.T) {
+	t.Parallel()
+	store := storage.NewMemoryStore()
+	user := CreateTestUser(t, store, "memory", "memory#123", models.RoleMember)
+
+	// User names are unique
+	if err := store.Users.Create(&models.User{UserName: "memory"}); err != storage.ErrDuplicate {
+		t.Fatalf("Expected to get %v but instead got %v\n", storage.ErrDuplicate, err)
+	}
+
+	// Only the given columns are saved
+	user.FullName = "Memory User"
+	user.Role = models.RoleAdmin
+	if err := store.Users.Update(&user, "full_name"); err != nil {
+		t.Fatalf("Couldn't update user: %v\n", err)
+	}
+	found, err := store.Users.FindByUserName("memory")
+	if err != nil || found.FullName != "Memory User" || found.Role != models.RoleMember {
+		t.Fatalf("Expected only the full name to change but instead got %+v, %v\n", found, err)
+	}
+
+	// Revoking the sessions of the user also revokes their refresh tokens
+	session := models.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	store.Sessions.Create(&session)
+	refreshToken := models.RefreshToken{UserID: user.ID, SessionID: session.ID, TokenHash: "hash"}
+	store.Tokens.CreateRefreshToken(&refreshToken)
+	if err := store.Sessions.RevokeAll(user.ID, 0); err != nil {
+		t.Fatalf("Couldn't revoke sessions: %v\n", err)
+	}
+	if used, _ := store.Tokens.UseRefreshToken(refreshToken.ID); used {
+		t.Fatalf("Expected the refresh token to be revoked\n")
+	}
+	if sessions, _ := store.Sessions.ListActive(user.ID); len(sessions) != 0 {
+		t.Fatalf("Expected no active sessions but instead got %d\n", len(sessions))
+	}
+
+	// Deleted users are not found
+	store.Users.Delete(user.ID)
+	if _, err := store.Users.FindByID(user.ID); err != storage.ErrNotFound {
+		t.Fatalf("Expected to get %v but instead got %v\n", storage.ErrNotFound, err)
+	}
+}
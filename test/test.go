@@ -3,27 +3,92 @@ package test
 import (
 	"bytes"
 	"encoding/json"
+	"ionixx/api/config"
 	"ionixx/api/controllers"
+	"ionixx/api/logging"
+	"ionixx/api/models"
+	"ionixx/api/response"
+	"ionixx/api/signing"
 	"ionixx/api/storage"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// Auth config of the test controllers, passwords are hashed with the minimum cost to keep the tests fast
+	TestAuthConfig = func() config.AuthConfig {
+		auth := config.Default().Auth
+		auth.BcryptCost = bcrypt.MinCost
+		return auth
+	}()
+
+	// Signing keys of the test controllers and middlewares, generated once for every test
+	TestKeys = signing.InitKeys(config.JWTConfig{EphemeralKeys: true}, logging.Discard)
+
+	setupOnce sync.Once
+	// Tests sharing the postgres database can't run at the same time
+	postgresLock sync.Mutex
 )
 
 /**
- * Function setup the test server
+ * Function setup the test server and the store its controllers are created with
  */
-func SetupTestServer() *gin.Engine {
-	// Switch to test mode
-	gin.SetMode(gin.TestMode)
-
-	storage.InitTestDB()
-	// Setup router, just like main function
-	r := gin.Default()
-	return r
+func SetupTestServer(t *testing.T) (*gin.Engine, *storage.Store) {
+	// Switch to test mode once for every test
+	setupOnce.Do(func() {
+		gin.SetMode(gin.TestMode)
+	})
+
+	store := NewTestStore(t)
+	// Setup router, just like main function with no trusted proxy
+	r := gin.New()
+	if err := r.SetTrustedProxies(nil); err != nil {
+		t.Fatalf("Couldn't set the trusted proxies: %v\n", err)
+	}
+	r.Use(logging.Middleware(logging.Discard), logging.Recovery())
+	return r, store
+}
+
+/**
+ * Function to create the store of a test, selected by the TEST_DB_DRIVER environment variable:
+ * sqlite (default) for a private in-memory database, memory for the in-memory store
+ * or postgres for the database of the DSN
+ */
+func NewTestStore(t *testing.T) *storage.Store {
+	switch driver := os.Getenv("TEST_DB_DRIVER"); driver {
+	case "memory":
+		return storage.NewMemoryStore()
+	case "postgres":
+		// Hold the database until the test is done, its tables are dropped by the next one
+		postgresLock.Lock()
+		t.Cleanup(postgresLock.Unlock)
+		return openTestStore(t, driver, os.Getenv("DSN"))
+	case "", "sqlite":
+		return openTestStore(t, "sqlite", "file::memory:")
+	default:
+		t.Fatalf("Unknown test database driver %q\n", driver)
+		return nil
+	}
+}
+
+/**
+ * Function to open an empty test database, it is closed when the test is done
+ */
+func openTestStore(t *testing.T, driver string, dsn string) *storage.Store {
+	db, err := storage.InitTestDB(driver, dsn)
+	if err != nil {
+		t.Fatalf("Couldn't open test database: %v\n", err)
+	}
+	store := storage.NewGormStore(db)
+	t.Cleanup(func() { store.Close() })
+	return store
 }
 
 func GetUserPayload() ([]byte, error) {
@@ -50,8 +115,8 @@ func GetInvalidUserPayload() ([]byte, error) {
 /**
  * Function to seed a new user
  */
-func SeedNewUser(r *gin.Engine, t *testing.T) {
-	userController := controllers.UserController{}
+func SeedNewUser(r *gin.Engine, t *testing.T, store *storage.Store) {
+	userController := controllers.NewUserController(store, TestAuthConfig)
 	r.POST("/", userController.CreateUser)
 
 	data, err := GetUserPayload()
@@ -72,3 +137,87 @@ func SeedNewUser(r *gin.Engine, t *testing.T) {
 	// Perform the request
 	r.ServeHTTP(w, req)
 }
+
+/**
+ * Function to decode the data of a json response into the given value
+ */
+func DecodeResponseData(t *testing.T, w *httptest.ResponseRecorder, data interface{}) {
+	body := response.Response{Data: data}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Couldn't decode response: %v\n", err)
+	}
+}
+
+/**
+ * Function to login the seeded user, the login route must be registered at /login
+ */
+func LoginSeededUser(r *gin.Engine, t *testing.T) controllers.LoginResponse {
+	return LoginUser(r, t, "tester", "test#123")
+}
+
+/**
+ * Function to login a user, the login route must be registered at /login
+ */
+func LoginUser(r *gin.Engine, t *testing.T, userName string, password string) controllers.LoginResponse {
+	data, err := json.Marshal(controllers.LoginRequest{UserName: userName, Password: password})
+	if err != nil {
+		t.Fatalf("Couldn't create request: %v\n", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "/login", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Couldn't create request: %v\n", err)
+	}
+
+	// Create a response recorder to inspect the response
+	w := httptest.NewRecorder()
+
+	// Perform the request
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to login with status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+
+	var loginResponse controllers.LoginResponse
+	DecodeResponseData(t, w, &loginResponse)
+	return loginResponse
+}
+
+/**
+ * Function to create a user with the given role directly in the store
+ */
+func CreateTestUser(t *testing.T, store *storage.Store, userName string, password string, role string) models.User {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Couldn't hash password: %v\n", err)
+	}
+	user := models.User{
+		UserName: userName,
+		Password: string(hashedPassword),
+		FullName: userName,
+		Role:     role,
+	}
+	if err := store.Users.Create(&user); err != nil {
+		t.Fatalf("Couldn't create user: %v\n", err)
+	}
+	return user
+}
+
+/**
+ * Function to perform a request with the given bearer token
+ */
+func PerformAuthorizedRequest(r *gin.Engine, t *testing.T, method string, path string, token string, body []byte) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, path, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Couldn't create request: %v\n", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	// Create a response recorder to inspect the response
+	w := httptest.NewRecorder()
+
+	// Perform the request
+	r.ServeHTTP(w, req)
+	return w
+}
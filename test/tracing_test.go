@@ -0,0 +1,117 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"ionixx/api/config"
+	"ionixx/api/controllers"
+	"ionixx/api/middlewares"
+	"ionixx/api/models"
+	"ionixx/api/tracing"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Trace and parent span of the traceparent header sent by the test client
+const (
+	clientTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	clientSpanID  = "00f067aa0ba902b7"
+)
+
+/**
+ * Function to find the span with the name, it fails the test when there is none
+ */
+func findSpan(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("Expected a span named %s\n", name)
+	return tracetest.SpanStub{}
+}
+
+/**
+ * Function to test the spans of a request
+ * case: success, the request continues the trace of the client and has a span for each handler, SQL statement and bcrypt
+ */
+func TestTracing(t *testing.T) {
+	// The tracer provider is global, the test doesn't run in parallel with the others
+	if _, err := tracing.Init(config.TracingConfig{Exporter: "none"}); err != nil {
+		t.Fatalf("Couldn't init tracing: %v\n", err)
+	}
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+		provider.Shutdown(context.Background())
+	})
+
+	r, store := SetupTestServer(t)
+	r.Use(tracing.Middleware())
+	authController := controllers.NewAuthController(store, TestAuthConfig, TestKeys)
+	userController := controllers.NewUserController(store, TestAuthConfig)
+	r.POST("/login", tracing.Handler(authController.Login))
+	r.GET("/user/:id", tracing.Handler(middlewares.AuthMiddleware(store, TestKeys)), tracing.Handler(userController.GetUserByID))
+	user := CreateTestUser(t, store, "traced", "traced#123", models.RoleMember)
+	loginResponse := LoginUser(r, t, "traced", "traced#123")
+
+	if compare := findSpan(t, exporter.GetSpans(), "bcrypt.compare"); !compare.Parent.IsValid() {
+		t.Fatalf("Expected the bcrypt span to be a child of the login span\n")
+	}
+	exporter.Reset()
+
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/user/%d", user.ID), nil)
+	req.Header.Set("Authorization", "Bearer "+loginResponse.AccessToken)
+	req.Header.Set("traceparent", fmt.Sprintf("00-%s-%s-01", clientTraceID, clientSpanID))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusOK, w.Code)
+	}
+	// The client can find the trace of its request
+	if traceparent := w.Header().Get("traceparent"); !strings.Contains(traceparent, clientTraceID) {
+		t.Fatalf("Expected the traceparent response header to continue the trace but instead got %q\n", traceparent)
+	}
+
+	spans := exporter.GetSpans()
+	for _, span := range spans {
+		if span.SpanContext.TraceID().String() != clientTraceID {
+			t.Fatalf("Expected span %s to be part of the client trace\n", span.Name)
+		}
+	}
+	request := findSpan(t, spans, "GET /user/:id")
+	if request.Parent.SpanID().String() != clientSpanID || !request.Parent.IsRemote() {
+		t.Fatalf("Expected the request span to be a child of the client span\n")
+	}
+	// The middleware and the controller are siblings under the request
+	auth := findSpan(t, spans, "middlewares.AuthMiddleware")
+	controller := findSpan(t, spans, "controllers.UserController.GetUserByID")
+	for _, span := range []tracetest.SpanStub{auth, controller} {
+		if span.Parent.SpanID() != request.SpanContext.SpanID() {
+			t.Fatalf("Expected span %s to be a child of the request span\n", span.Name)
+		}
+	}
+
+	// The memory store runs no SQL
+	if pool, _ := store.ConnectionPool(); pool == nil {
+		return
+	}
+	parents := map[trace.SpanID]int{}
+	for _, span := range spans {
+		if strings.HasPrefix(span.Name, "gorm.") {
+			parents[span.Parent.SpanID()]++
+		}
+	}
+	if parents[auth.SpanContext.SpanID()] == 0 || parents[controller.SpanContext.SpanID()] == 0 {
+		t.Fatalf("Expected SQL spans under the middleware and the controller but instead got %v\n", parents)
+	}
+}
@@ -14,8 +14,9 @@ import (
  * case: success
  */
 func TestCreateUserSuccess(t *testing.T) {
-	r := SetupTestServer()
-	userController := controllers.UserController{}
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	userController := controllers.NewUserController(store, TestAuthConfig)
 	r.POST("/", userController.CreateUser)
 	data, err := GetUserPayload()
 	if err != nil {
@@ -47,9 +48,10 @@ func TestCreateUserSuccess(t *testing.T) {
  * case: failed
  */
 func TestCreateUserFailed(t *testing.T) {
+	t.Parallel()
 
-	r := SetupTestServer()
-	userController := controllers.UserController{}
+	r, store := SetupTestServer(t)
+	userController := controllers.NewUserController(store, TestAuthConfig)
 	r.POST("/", userController.CreateUser)
 
 	data, err := GetInvalidUserPayload()
@@ -71,10 +73,10 @@ func TestCreateUserFailed(t *testing.T) {
 	r.ServeHTTP(w, req)
 	fmt.Println(w.Body)
 
-	if w.Code == http.StatusBadRequest {
-		t.Logf("Expected to get status %d is same ast %d\n", http.StatusBadRequest, w.Code)
+	if w.Code == http.StatusUnprocessableEntity {
+		t.Logf("Expected to get status %d is same ast %d\n", http.StatusUnprocessableEntity, w.Code)
 	} else {
-		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusBadRequest, w.Code)
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusUnprocessableEntity, w.Code)
 	}
 }
 
@@ -83,10 +85,11 @@ func TestCreateUserFailed(t *testing.T) {
  * case: success
  */
 func TestGetAllUsers(t *testing.T) {
-	r := SetupTestServer()
-	userController := controllers.UserController{}
+	t.Parallel()
+	r, store := SetupTestServer(t)
+	userController := controllers.NewUserController(store, TestAuthConfig)
 	r.GET("/", userController.GetAllUsers)
-	SeedNewUser(r, t)
+	SeedNewUser(r, t, store)
 
 	req, err := http.NewRequest(http.MethodGet, "/", nil)
 
@@ -112,11 +115,12 @@ func TestGetAllUsers(t *testing.T) {
  * case: sucess
  */
 func TestGetUserByIDSuccess(t *testing.T) {
+	t.Parallel()
 
-	r := SetupTestServer()
-	userController := controllers.UserController{}
+	r, store := SetupTestServer(t)
+	userController := controllers.NewUserController(store, TestAuthConfig)
 	r.GET("/:id", userController.GetUserByID)
-	SeedNewUser(r, t)
+	SeedNewUser(r, t, store)
 
 	req, err := http.NewRequest(http.MethodGet, "/1", nil)
 
@@ -143,9 +147,10 @@ func TestGetUserByIDSuccess(t *testing.T) {
  * case: fail
  */
 func TestGetUserByIDFailed(t *testing.T) {
+	t.Parallel()
 
-	r := SetupTestServer()
-	userController := controllers.UserController{}
+	r, store := SetupTestServer(t)
+	userController := controllers.NewUserController(store, TestAuthConfig)
 	r.GET("/:id", userController.GetUserByID)
 
 	req, err := http.NewRequest(http.MethodGet, "/-1", nil)
@@ -161,9 +166,9 @@ func TestGetUserByIDFailed(t *testing.T) {
 	r.ServeHTTP(w, req)
 	fmt.Println(w.Body)
 
-	if w.Code == http.StatusBadRequest {
-		t.Logf("Expected to get status %d is same ast %d\n", http.StatusBadRequest, w.Code)
+	if w.Code == http.StatusNotFound {
+		t.Logf("Expected to get status %d is same ast %d\n", http.StatusNotFound, w.Code)
 	} else {
-		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusBadRequest, w.Code)
+		t.Fatalf("Expected to get status %d but instead got %d\n", http.StatusNotFound, w.Code)
 	}
 }